@@ -0,0 +1,14 @@
+-- user-003: analysis status of every sample
+USE veea;
+
+ALTER TABLE video_view_time
+  ADD COLUMN status TINYINT NOT NULL DEFAULT 2 AFTER quality,
+  ADD COLUMN people_count INT NOT NULL DEFAULT 0 AFTER status,
+  ADD COLUMN people_success_count INT NOT NULL DEFAULT 0 AFTER people_count,
+  ADD COLUMN failures TEXT AFTER people_success_count;
+
+-- samples stored before were analyzed when they were received
+UPDATE video_view_time AS T SET
+  T.status = 3,
+  T.people_success_count = (SELECT COUNT(*) FROM video_view_stats AS S WHERE S.view_time_id = T.id),
+  T.people_count = T.people_success_count;
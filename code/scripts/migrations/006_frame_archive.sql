@@ -0,0 +1,16 @@
+-- user-006: archive of the raw frames of a video
+USE veea;
+
+ALTER TABLE video
+  ADD COLUMN archive_frames TINYINT NOT NULL DEFAULT 0 AFTER name,
+  ADD COLUMN frame_retention_days INT NOT NULL DEFAULT 30 AFTER archive_frames;
+
+CREATE TABLE IF NOT EXISTS video_view_frame (
+  view_time_id INT PRIMARY KEY,
+  hash CHAR(64) NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  INDEX (hash),
+  FOREIGN KEY (view_time_id) REFERENCES video_view_time (id)
+    ON DELETE CASCADE
+    ON UPDATE CASCADE
+);
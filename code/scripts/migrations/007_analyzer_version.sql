@@ -0,0 +1,8 @@
+-- user-007: version of the analyzer behind every stats row
+USE veea;
+
+ALTER TABLE video_view_stats
+  ADD COLUMN analyzer_version VARCHAR(40) NOT NULL DEFAULT '' AFTER engagement;
+
+-- every row stored before came from the image processing service
+UPDATE video_view_stats SET analyzer_version = 'crowdsight-1';
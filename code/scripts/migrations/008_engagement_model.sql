@@ -0,0 +1,8 @@
+-- user-008: engagement scoring model of every video and stats row
+USE veea;
+
+ALTER TABLE video
+  ADD COLUMN engagement_model VARCHAR(40) NOT NULL DEFAULT 'rms-v1' AFTER frame_retention_days;
+
+ALTER TABLE video_view_stats
+  ADD COLUMN engagement_model VARCHAR(40) NOT NULL DEFAULT 'rms-v1' AFTER engagement;
@@ -0,0 +1,20 @@
+-- user-009: resumable engagement recompute jobs
+USE veea;
+
+CREATE TABLE IF NOT EXISTS engagement_job (
+  id INT PRIMARY KEY AUTO_INCREMENT,
+  video_id VARCHAR(20),
+  engagement_model VARCHAR(40) NOT NULL,
+  status TINYINT NOT NULL DEFAULT 0,
+  last_stats_id INT NOT NULL DEFAULT 0,
+  processed INT NOT NULL DEFAULT 0,
+  total INT NOT NULL DEFAULT 0,
+  attempts INT NOT NULL DEFAULT 0,
+  error VARCHAR(255),
+  locked_until TIMESTAMP NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  FOREIGN KEY (video_id) REFERENCES video (video_id)
+    ON DELETE CASCADE
+    ON UPDATE CASCADE
+);
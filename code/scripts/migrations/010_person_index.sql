@@ -0,0 +1,9 @@
+-- user-010: person a face belongs to within its view
+USE veea;
+
+ALTER TABLE video_view_stats
+  ADD COLUMN person_index INT NOT NULL DEFAULT 0 AFTER view_time_id,
+  ADD INDEX (view_time_id, person_index);
+
+ALTER TABLE video_view_time
+  ADD INDEX (view_id, id);
@@ -0,0 +1,19 @@
+-- user-011: player events of every view
+USE veea;
+
+CREATE TABLE IF NOT EXISTS video_view_event (
+  id INT PRIMARY KEY AUTO_INCREMENT,
+  view_id VARCHAR(80) NOT NULL,
+  type VARCHAR(20) NOT NULL,
+  video_time FLOAT NOT NULL,
+  client_time BIGINT NOT NULL,
+  from_time FLOAT,
+  to_time FLOAT,
+  quality VARCHAR(20),
+  rate FLOAT,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  INDEX (view_id, client_time),
+  FOREIGN KEY (view_id) REFERENCES video_view (view_id)
+    ON DELETE CASCADE
+    ON UPDATE CASCADE
+);
@@ -0,0 +1,18 @@
+-- user-012: playback timeline of every view
+USE veea;
+
+ALTER TABLE video_view
+  ADD COLUMN timeline_updated_at TIMESTAMP NULL AFTER view_duration;
+
+CREATE TABLE IF NOT EXISTS video_view_segment (
+  id INT PRIMARY KEY AUTO_INCREMENT,
+  view_id VARCHAR(80) NOT NULL,
+  kind VARCHAR(10) NOT NULL,
+  start_time FLOAT NOT NULL,
+  end_time FLOAT NOT NULL,
+  duration FLOAT NOT NULL,
+  INDEX (view_id, kind),
+  FOREIGN KEY (view_id) REFERENCES video_view (view_id)
+    ON DELETE CASCADE
+    ON UPDATE CASCADE
+);
@@ -0,0 +1,6 @@
+-- user-013: sequence number of every sample within its view
+USE veea;
+
+ALTER TABLE video_view_time
+  ADD COLUMN seq INT AFTER view_id,
+  ADD UNIQUE (view_id, seq);
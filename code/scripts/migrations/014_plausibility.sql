@@ -0,0 +1,9 @@
+-- user-014: duration of every video and flag of implausible samples
+USE veea;
+
+ALTER TABLE video
+  ADD COLUMN duration FLOAT NOT NULL DEFAULT 0 AFTER engagement_model;
+
+ALTER TABLE video_view_time
+  ADD COLUMN client_time BIGINT AFTER seq,
+  ADD COLUMN flag VARCHAR(20) AFTER failures;
@@ -0,0 +1,8 @@
+-- user-015: token buckets shared by all the instances
+USE veea;
+
+CREATE TABLE IF NOT EXISTS rate_limit_bucket (
+  bucket_key VARCHAR(120) PRIMARY KEY,
+  tokens DOUBLE NOT NULL,
+  updated_at DOUBLE NOT NULL
+);
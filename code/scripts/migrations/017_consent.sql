@@ -0,0 +1,32 @@
+-- user-017: versioned webcam consent
+USE veea;
+
+CREATE TABLE IF NOT EXISTS consent_text (
+  version INT PRIMARY KEY AUTO_INCREMENT,
+  body TEXT NOT NULL,
+  created_by INT,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (created_by) REFERENCES user (id)
+    ON DELETE SET NULL
+    ON UPDATE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS consent (
+  id INT PRIMARY KEY AUTO_INCREMENT,
+  user_id INT NOT NULL,
+  version INT NOT NULL,
+  accepted_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE (user_id, version),
+  FOREIGN KEY (user_id) REFERENCES user (id)
+    ON DELETE CASCADE
+    ON UPDATE CASCADE,
+  FOREIGN KEY (version) REFERENCES consent_text (version)
+    ON DELETE RESTRICT
+    ON UPDATE CASCADE
+);
+
+ALTER TABLE video_view
+  ADD COLUMN consent_id INT AFTER timeline_updated_at,
+  ADD FOREIGN KEY (consent_id) REFERENCES consent (id)
+    ON DELETE RESTRICT
+    ON UPDATE CASCADE;
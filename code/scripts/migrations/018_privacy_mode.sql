@@ -0,0 +1,19 @@
+-- user-018: privacy mode of every video, demographics can be left out
+USE veea;
+
+ALTER TABLE video
+  ADD COLUMN privacy_mode VARCHAR(20) NOT NULL DEFAULT 'full' AFTER duration;
+
+ALTER TABLE video_view_stats
+  MODIFY gender FLOAT,
+  MODIFY age INT,
+  ADD COLUMN age_bucket TINYINT AFTER age;
+
+-- age range of the rows stored before, the same ranges as privacy.AgeBucket
+UPDATE video_view_stats SET age_bucket = CASE
+    WHEN age < 18 THEN 0
+    WHEN age < 31 THEN 1
+    WHEN age < 51 THEN 2
+    ELSE 3
+  END
+  WHERE age IS NOT NULL AND age >= 0;
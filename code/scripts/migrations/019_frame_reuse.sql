@@ -0,0 +1,8 @@
+-- user-019: frame hashes and reuse of the previous analysis
+USE veea;
+
+ALTER TABLE video_view_time
+  ADD COLUMN frame_hash CHAR(64) AFTER flag,
+  ADD COLUMN frame_dhash BIGINT AFTER frame_hash,
+  ADD COLUMN reused_from INT AFTER frame_dhash,
+  ADD INDEX (reused_from);
@@ -0,0 +1,5 @@
+-- user-021: reason a frame was rejected before analysis
+USE veea;
+
+ALTER TABLE video_view_time
+  ADD COLUMN rejected VARCHAR(20) AFTER flag;
@@ -0,0 +1,5 @@
+-- user-022: videos that can be watched without a webcam
+USE veea;
+
+ALTER TABLE video
+  ADD COLUMN camera_optional TINYINT NOT NULL DEFAULT 0 AFTER privacy_mode;
@@ -0,0 +1,7 @@
+-- user-024: views are finalized once
+USE veea;
+
+ALTER TABLE video_view
+  ADD COLUMN finalized_at TIMESTAMP NULL AFTER consent_id,
+  ADD COLUMN finalize_error VARCHAR(255) AFTER finalized_at,
+  ADD INDEX (finalized_at, created_at);
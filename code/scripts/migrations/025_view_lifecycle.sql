@@ -0,0 +1,8 @@
+-- user-025: views started, kept alive and ended by the player
+USE veea;
+
+ALTER TABLE video_view
+  ADD COLUMN started_at TIMESTAMP NULL AFTER consent_id,
+  ADD COLUMN last_heartbeat_at TIMESTAMP NULL AFTER started_at,
+  ADD COLUMN ended_at TIMESTAMP NULL AFTER last_heartbeat_at,
+  ADD COLUMN end_reason VARCHAR(20) AFTER ended_at;
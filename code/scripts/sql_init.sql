@@ -26,9 +26,39 @@ CREATE TABLE IF NOT EXISTS session (
     ON UPDATE CASCADE
 );
 
+CREATE TABLE IF NOT EXISTS consent_text (
+  version INT PRIMARY KEY AUTO_INCREMENT,
+  body TEXT NOT NULL,
+  created_by INT,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  FOREIGN KEY (created_by) REFERENCES user (id)
+    ON DELETE SET NULL
+    ON UPDATE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS consent (
+  id INT PRIMARY KEY AUTO_INCREMENT,
+  user_id INT NOT NULL,
+  version INT NOT NULL,
+  accepted_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE (user_id, version),
+  FOREIGN KEY (user_id) REFERENCES user (id)
+    ON DELETE CASCADE
+    ON UPDATE CASCADE,
+  FOREIGN KEY (version) REFERENCES consent_text (version)
+    ON DELETE RESTRICT
+    ON UPDATE CASCADE
+);
+
 CREATE TABLE IF NOT EXISTS video (
   video_id VARCHAR(20) PRIMARY KEY,
   name VARCHAR(160) NOT NULL,
+  archive_frames TINYINT NOT NULL DEFAULT 0,
+  frame_retention_days INT NOT NULL DEFAULT 30,
+  engagement_model VARCHAR(40) NOT NULL DEFAULT 'rms-v1',
+  duration FLOAT NOT NULL DEFAULT 0,
+  privacy_mode VARCHAR(20) NOT NULL DEFAULT 'full',
+  camera_optional TINYINT NOT NULL DEFAULT 0,
   created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
 );
 
@@ -37,23 +67,49 @@ CREATE TABLE IF NOT EXISTS video_view (
   video_id VARCHAR(20),
   view_id VARCHAR(80) UNIQUE,
   view_duration FLOAT NOT NULL DEFAULT -1,
+  timeline_updated_at TIMESTAMP NULL,
+  consent_id INT,
+  started_at TIMESTAMP NULL,
+  last_heartbeat_at TIMESTAMP NULL,
+  ended_at TIMESTAMP NULL,
+  end_reason VARCHAR(20),
+  finalized_at TIMESTAMP NULL,
+  finalize_error VARCHAR(255),
   created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  INDEX (finalized_at, created_at),
   FOREIGN KEY (video_id) REFERENCES video (video_id)
     ON DELETE CASCADE
     ON UPDATE CASCADE,
   FOREIGN KEY (user_id) REFERENCES user (id)
     ON DELETE CASCADE
     ON UPDATE CASCADE,
+  FOREIGN KEY (consent_id) REFERENCES consent (id)
+    ON DELETE RESTRICT
+    ON UPDATE CASCADE,
   PRIMARY KEY (video_id, view_id)
 );
 
 CREATE TABLE IF NOT EXISTS video_view_time (
   id INT PRIMARY KEY AUTO_INCREMENT,
   view_id VARCHAR(80) NOT NULL,
+  seq INT,
+  client_time BIGINT,
   time FLOAT NOT NULL,
   state TINYINT NOT NULL,
   quality VARCHAR(20) NOT NULL,
+  status TINYINT NOT NULL DEFAULT 2,
+  people_count INT NOT NULL DEFAULT 0,
+  people_success_count INT NOT NULL DEFAULT 0,
+  failures TEXT,
+  flag VARCHAR(20),
+  rejected VARCHAR(20),
+  frame_hash CHAR(64),
+  frame_dhash BIGINT,
+  reused_from INT,
   created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE (view_id, seq),
+  INDEX (view_id, id),
+  INDEX (reused_from),
   FOREIGN KEY (view_id) REFERENCES video_view (view_id)
     ON DELETE CASCADE
     ON UPDATE CASCADE
@@ -62,8 +118,10 @@ CREATE TABLE IF NOT EXISTS video_view_time (
 CREATE TABLE IF NOT EXISTS video_view_stats (
   id INT PRIMARY KEY AUTO_INCREMENT,
   view_time_id INT NOT NULL,
-  gender FLOAT NOT NULL,
-  age INT NOT NULL,
+  person_index INT NOT NULL DEFAULT 0,
+  gender FLOAT,
+  age INT,
+  age_bucket TINYINT,
   mood FLOAT NOT NULL,
   head_yaw FLOAT NOT NULL,
   head_pitch FLOAT NOT NULL,
@@ -80,7 +138,74 @@ CREATE TABLE IF NOT EXISTS video_view_stats (
   afraid FLOAT NOT NULL,
   sad FLOAT NOT NULL,
   engagement FLOAT NOT NULL DEFAULT 1,
+  engagement_model VARCHAR(40) NOT NULL DEFAULT 'rms-v1',
+  analyzer_version VARCHAR(40) NOT NULL DEFAULT '',
+  INDEX (view_time_id, person_index),
   FOREIGN KEY (view_time_id) REFERENCES video_view_time (id)
     ON DELETE CASCADE
     ON UPDATE CASCADE
 );
+
+CREATE TABLE IF NOT EXISTS video_view_event (
+  id INT PRIMARY KEY AUTO_INCREMENT,
+  view_id VARCHAR(80) NOT NULL,
+  type VARCHAR(20) NOT NULL,
+  video_time FLOAT NOT NULL,
+  client_time BIGINT NOT NULL,
+  from_time FLOAT,
+  to_time FLOAT,
+  quality VARCHAR(20),
+  rate FLOAT,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  INDEX (view_id, client_time),
+  FOREIGN KEY (view_id) REFERENCES video_view (view_id)
+    ON DELETE CASCADE
+    ON UPDATE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS video_view_segment (
+  id INT PRIMARY KEY AUTO_INCREMENT,
+  view_id VARCHAR(80) NOT NULL,
+  kind VARCHAR(10) NOT NULL,
+  start_time FLOAT NOT NULL,
+  end_time FLOAT NOT NULL,
+  duration FLOAT NOT NULL,
+  INDEX (view_id, kind),
+  FOREIGN KEY (view_id) REFERENCES video_view (view_id)
+    ON DELETE CASCADE
+    ON UPDATE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS video_view_frame (
+  view_time_id INT PRIMARY KEY,
+  hash CHAR(64) NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  INDEX (hash),
+  FOREIGN KEY (view_time_id) REFERENCES video_view_time (id)
+    ON DELETE CASCADE
+    ON UPDATE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS engagement_job (
+  id INT PRIMARY KEY AUTO_INCREMENT,
+  video_id VARCHAR(20),
+  engagement_model VARCHAR(40) NOT NULL,
+  status TINYINT NOT NULL DEFAULT 0,
+  last_stats_id INT NOT NULL DEFAULT 0,
+  processed INT NOT NULL DEFAULT 0,
+  total INT NOT NULL DEFAULT 0,
+  attempts INT NOT NULL DEFAULT 0,
+  error VARCHAR(255),
+  locked_until TIMESTAMP NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  FOREIGN KEY (video_id) REFERENCES video (video_id)
+    ON DELETE CASCADE
+    ON UPDATE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS rate_limit_bucket (
+  bucket_key VARCHAR(120) PRIMARY KEY,
+  tokens DOUBLE NOT NULL,
+  updated_at DOUBLE NOT NULL
+);
@@ -0,0 +1,43 @@
+package analyzer
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gpahal/veea/conf"
+)
+
+type FaceAnalyzer interface {
+	Analyze(image []byte) (*Result, error)
+	Version() string
+}
+
+// returned when the analyzer replies with an error object instead of a list
+// of people (for example when no face could be found in the image)
+type ReplyError struct {
+	Reply map[string]interface{}
+}
+
+func (re *ReplyError) Error() string {
+	return fmt.Sprintf("analyzer replied with an error: %v", re.Reply)
+}
+
+var current FaceAnalyzer
+
+func init() {
+	if conf.AnalyzerStub {
+		current = NewStubAnalyzer()
+	} else {
+		fa := NewHttpAnalyzer(conf.AnalyzerUrl, conf.AnalyzerVersion, time.Duration(conf.AnalyzerTimeout) * time.Second, conf.AnalyzerAuthToken)
+		breaker := NewBreaker(conf.AnalyzerBreakerFailures, time.Duration(conf.AnalyzerBreakerCooldown) * time.Second)
+		current = NewResilientAnalyzer(fa, conf.AnalyzerRetries, time.Duration(conf.AnalyzerRetryBackoff) * time.Millisecond, breaker)
+	}
+}
+
+func Get() FaceAnalyzer {
+	return current
+}
+
+func Set(fa FaceAnalyzer) {
+	current = fa
+}
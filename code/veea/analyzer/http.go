@@ -0,0 +1,64 @@
+package analyzer
+
+import (
+	"time"
+	"strings"
+	"net/url"
+	"net/http"
+	"io/ioutil"
+)
+
+type HttpAnalyzer struct {
+	Url          string
+	ModelVersion string
+	Timeout      time.Duration
+	AuthToken    string
+
+	client *http.Client
+}
+
+func NewHttpAnalyzer(requestUrl string, modelVersion string, timeout time.Duration, authToken string) *HttpAnalyzer {
+	return &HttpAnalyzer{
+		Url: requestUrl,
+		ModelVersion: modelVersion,
+		Timeout: timeout,
+		AuthToken: authToken,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (ha *HttpAnalyzer) Version() string {
+	return ha.ModelVersion
+}
+
+func (ha *HttpAnalyzer) Analyze(image []byte) (*Result, error) {
+	form := url.Values{}
+	form.Add("file", string(image))
+
+	req, err := http.NewRequest("POST", ha.Url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if ha.AuthToken != "" {
+		req.Header.Set("Authorization", "Bearer " + ha.AuthToken)
+	}
+
+	resp, err := ha.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &StatusError{StatusCode: resp.StatusCode}
+	}
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return Decode(respBody)
+}
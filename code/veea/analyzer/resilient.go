@@ -0,0 +1,202 @@
+package analyzer
+
+import (
+	"io"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+	"errors"
+	"net/url"
+	"math/rand"
+)
+
+// returned without calling the analyzer while its circuit breaker is open
+var ErrUnavailable = errors.New("Analyzer is unavailable")
+
+// returned when the analyzer answers with a status code other than 200
+type StatusError struct {
+	StatusCode int
+}
+
+func (se *StatusError) Error() string {
+	return fmt.Sprintf("analyzer replied with status %d", se.StatusCode)
+}
+
+// states of a circuit breaker
+const (
+	breakerClosed = 0
+	breakerOpen = 1
+	breakerHalfOpen = 2
+)
+
+// Breaker opens after a number of consecutive failed calls and then fails
+// fast for Cooldown. After that a single trial call is let through, which
+// closes it again if it succeeds and reopens it if it fails.
+type Breaker struct {
+	Failures int
+	Cooldown time.Duration
+
+	lock     sync.Mutex
+	state    int
+	failures int
+	openedAt time.Time
+	trialAt  time.Time
+}
+
+func NewBreaker(failures int, cooldown time.Duration) *Breaker {
+	return &Breaker{Failures: failures, Cooldown: cooldown}
+}
+
+// Allow reports if a call can be made now
+func (b *Breaker) Allow() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.Cooldown {
+			return false
+		}
+		b.state = breakerHalfOpen
+		b.trialAt = time.Now()
+		return true
+	case breakerHalfOpen:
+		// only the trial call is let through, unless it never reported back
+		if time.Since(b.trialAt) < b.Cooldown {
+			return false
+		}
+		b.trialAt = time.Now()
+		return true
+	default:
+		return true
+	}
+}
+
+func (b *Breaker) Success() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.state = breakerClosed
+	b.failures = 0
+}
+
+func (b *Breaker) Failure() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.failures += 1
+	if b.state == breakerHalfOpen || b.failures >= b.Failures {
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// Open reports if calls are currently refused and for about how long
+func (b *Breaker) Open() (bool, time.Duration) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		remaining := b.Cooldown - time.Since(b.openedAt)
+		if remaining <= 0 {
+			return false, 0
+		}
+		return true, remaining
+	case breakerHalfOpen:
+		return true, time.Second
+	default:
+		return false, 0
+	}
+}
+
+// ResilientAnalyzer retries the failed calls of another analyzer that may
+// succeed on a second try, waiting a random part of an exponentially growing
+// backoff between tries, and stops calling it while its breaker is open
+type ResilientAnalyzer struct {
+	Analyzer FaceAnalyzer
+	Retries  int
+	Backoff  time.Duration
+	Breaker  *Breaker
+}
+
+func NewResilientAnalyzer(fa FaceAnalyzer, retries int, backoff time.Duration, breaker *Breaker) *ResilientAnalyzer {
+	return &ResilientAnalyzer{
+		Analyzer: fa,
+		Retries: retries,
+		Backoff: backoff,
+		Breaker: breaker,
+	}
+}
+
+func (ra *ResilientAnalyzer) Version() string {
+	return ra.Analyzer.Version()
+}
+
+func (ra *ResilientAnalyzer) Analyze(image []byte) (*Result, error) {
+	if !ra.Breaker.Allow() {
+		return nil, ErrUnavailable
+	}
+
+	for attempt := 0; ; attempt += 1 {
+		result, err := ra.Analyzer.Analyze(image)
+		if err == nil || !transient(err) {
+			// the analyzer answered, even if it was with an error
+			ra.Breaker.Success()
+			return result, err
+		}
+
+		if attempt >= ra.Retries {
+			ra.Breaker.Failure()
+			return nil, err
+		}
+
+		time.Sleep(ra.backoff(attempt))
+	}
+}
+
+// backoff waits between half and all of Backoff * 2^attempt
+func (ra *ResilientAnalyzer) backoff(attempt int) time.Duration {
+	d := ra.Backoff << uint(attempt)
+	if d <= 0 {
+		return 0
+	}
+
+	return d / 2 + time.Duration(rand.Int63n(int64(d / 2) + 1))
+}
+
+func (ra *ResilientAnalyzer) Unavailable() (bool, time.Duration) {
+	return ra.Breaker.Open()
+}
+
+// transient reports if a call that failed with err may succeed if retried:
+// timeouts, connection errors and server errors. A request the client can't
+// make at all (a bad url, a refused certificate) fails the same way again.
+func transient(err error) bool {
+	switch e := err.(type) {
+	case *StatusError:
+		return e.StatusCode >= 500 || e.StatusCode == 429
+	case *url.Error:
+		return transient(e.Err)
+	case *net.OpError:
+		return true
+	case net.Error:
+		return e.Timeout() || e.Temporary()
+	default:
+		// the connection was closed before the whole response arrived
+		return err == io.EOF || err == io.ErrUnexpectedEOF
+	}
+}
+
+// Unavailable reports if the current analyzer refuses calls because it is
+// known to be down, and for about how long it will
+func Unavailable() (bool, time.Duration) {
+	if ua, ok := current.(interface {
+		Unavailable() (bool, time.Duration)
+	}); ok {
+		return ua.Unavailable()
+	}
+
+	return false, 0
+}
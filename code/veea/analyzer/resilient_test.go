@@ -0,0 +1,94 @@
+package analyzer
+
+import (
+	"io"
+	"net"
+	"time"
+	"errors"
+	"net/url"
+	"testing"
+)
+
+func TestBreaker(t *testing.T) {
+	const cooldown = 50 * time.Millisecond
+
+	// every step is a call reported as a success (s) or failure (f), a wait
+	// for the cooldown (w), and the state and whether calls are allowed after it
+	tests := []struct {
+		name    string
+		steps   string
+		state   int
+		allowed bool
+	}{
+		{"new", "", breakerClosed, true},
+		{"failures below the limit", "ff", breakerClosed, true},
+		{"success resets the count", "ffsff", breakerClosed, true},
+		{"failures reach the limit", "fff", breakerOpen, false},
+		{"cooldown passed", "fffw", breakerHalfOpen, true},
+		{"trial succeeds", "fffws", breakerClosed, true},
+		{"trial fails", "fffwf", breakerOpen, false},
+	}
+
+	for _, test := range tests {
+		b := NewBreaker(3, cooldown)
+		for _, step := range test.steps {
+			switch step {
+			case 's':
+				b.Success()
+			case 'f':
+				b.Failure()
+			case 'w':
+				time.Sleep(cooldown + 10 * time.Millisecond)
+			}
+		}
+
+		allowed := b.Allow()
+		if allowed != test.allowed {
+			t.Errorf("%s: allowed = %v, want %v", test.name, allowed, test.allowed)
+		}
+		if b.state != test.state {
+			t.Errorf("%s: state = %d, want %d", test.name, b.state, test.state)
+		}
+
+		// only the trial call goes through while the breaker is half open
+		if test.state == breakerHalfOpen && b.Allow() {
+			t.Errorf("%s: a second call was allowed while half open", test.name)
+		}
+
+		open, _ := b.Open()
+		if open != (test.state != breakerClosed) {
+			t.Errorf("%s: open = %v with state %d", test.name, open, test.state)
+		}
+	}
+}
+
+type timeoutError struct{}
+
+func (e timeoutError) Error() string   { return "timeout" }
+func (e timeoutError) Timeout() bool   { return true }
+func (e timeoutError) Temporary() bool { return true }
+
+func TestTransient(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+
+	tests := []struct {
+		name      string
+		err       error
+		transient bool
+	}{
+		{"server error", &StatusError{StatusCode: 503}, true},
+		{"too many requests", &StatusError{StatusCode: 429}, true},
+		{"bad request", &StatusError{StatusCode: 400}, false},
+		{"connection refused", &url.Error{Op: "Post", URL: "http://analyzer", Err: refused}, true},
+		{"timeout", &url.Error{Op: "Post", URL: "http://analyzer", Err: timeoutError{}}, true},
+		{"connection closed", &url.Error{Op: "Post", URL: "http://analyzer", Err: io.EOF}, true},
+		{"unsupported protocol", &url.Error{Op: "Post", URL: "ftp://analyzer", Err: errors.New("unsupported protocol scheme")}, false},
+		{"reply error", &ReplyError{Reply: map[string]interface{}{"error": "no image"}}, false},
+	}
+
+	for _, test := range tests {
+		if transient(test.err) != test.transient {
+			t.Errorf("%s: transient = %v, want %v", test.name, !test.transient, test.transient)
+		}
+	}
+}
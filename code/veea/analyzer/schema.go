@@ -0,0 +1,197 @@
+package analyzer
+
+import (
+	"fmt"
+	"errors"
+	"encoding/json"
+)
+
+// latest version of the analyzer response schema understood by this package
+const SchemaVersion = 1
+
+type HeadPose struct {
+	X     float64
+	Y     float64
+	Z     float64
+	Yaw   float64
+	Pitch float64
+	Roll  float64
+}
+
+type HeadGaze struct {
+	X float64
+	Y float64
+}
+
+type Emotions struct {
+	Happy     float64
+	Surprised float64
+	Angry     float64
+	Disgusted float64
+	Afraid    float64
+	Sad       float64
+}
+
+// a single validated face, independent of the schema version it was decoded from
+type Face struct {
+	Gender   string
+	Age      int
+	Mood     float64
+	HeadPose HeadPose
+	HeadGaze HeadGaze
+	Emotions Emotions
+}
+
+type FaceFailure struct {
+	Index  int    `json:"index"`
+	Reason string `json:"reason"`
+}
+
+type Result struct {
+	Version  int
+	Faces    []*Face
+	Failures []*FaceFailure
+}
+
+type faceDecoder func(raw json.RawMessage) (*Face, error)
+
+var decoders = map[int]faceDecoder{
+	1: decodeFaceV1,
+}
+
+// versioned responses are wrapped in an envelope, unversioned ones are a bare
+// list of faces in the version 1 format
+type envelope struct {
+	Version *int              `json:"version"`
+	Faces   []json.RawMessage `json:"faces"`
+}
+
+// Decode turns a raw analyzer response into a Result. Faces that fail
+// validation are left out of Result.Faces and recorded in Result.Failures.
+func Decode(body []byte) (*Result, error) {
+	var rawFaces []json.RawMessage
+	version := 1
+
+	err := json.Unmarshal(body, &rawFaces)
+	if err != nil {
+		var env envelope
+		var errorJson map[string]interface{}
+
+		err = json.Unmarshal(body, &errorJson)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("unable to parse analyzer response: %s", err.Error()))
+		}
+
+		if _, exists := errorJson["version"]; !exists {
+			return nil, &ReplyError{Reply: errorJson}
+		}
+
+		err = json.Unmarshal(body, &env)
+		if err != nil || env.Version == nil {
+			return nil, errors.New("unable to parse analyzer response envelope")
+		}
+
+		version = *env.Version
+		rawFaces = env.Faces
+	}
+
+	decoder, exists := decoders[version]
+	if !exists {
+		return nil, errors.New(fmt.Sprintf("unsupported analyzer schema version %d", version))
+	}
+
+	result := &Result{Version: version}
+
+	for idx, raw := range rawFaces {
+		face, err := decoder(raw)
+		if err != nil {
+			result.Failures = append(result.Failures, &FaceFailure{Index: idx, Reason: err.Error()})
+			continue
+		}
+		result.Faces = append(result.Faces, face)
+	}
+
+	return result, nil
+}
+
+type faceV1 struct {
+	Gender   *string   `json:"gender"`
+	Age      *float64  `json:"age"`
+	Mood     *float64  `json:"mood"`
+	HeadPose []float64 `json:"headpose"`
+	HeadGaze []float64 `json:"headgaze"`
+	Emotions []float64 `json:"emotions"`
+}
+
+func decodeFaceV1(raw json.RawMessage) (*Face, error) {
+	var f faceV1
+
+	err := json.Unmarshal(raw, &f)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("malformed face: %s", err.Error()))
+	}
+
+	err = errorFold(
+		required("gender", f.Gender != nil),
+		required("age", f.Age != nil),
+		required("mood", f.Mood != nil),
+		minLength("headpose", f.HeadPose, 6),
+		minLength("headgaze", f.HeadGaze, 2),
+		minLength("emotions", f.Emotions, 6),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Face{
+		Gender: *f.Gender,
+		Age: int(*f.Age),
+		Mood: *f.Mood,
+		HeadPose: HeadPose{
+			X: f.HeadPose[0],
+			Y: f.HeadPose[1],
+			Z: f.HeadPose[2],
+			Yaw: f.HeadPose[3],
+			Pitch: f.HeadPose[4],
+			Roll: f.HeadPose[5],
+		},
+		HeadGaze: HeadGaze{
+			X: f.HeadGaze[0],
+			Y: f.HeadGaze[1],
+		},
+		Emotions: Emotions{
+			Happy: f.Emotions[0],
+			Surprised: f.Emotions[1],
+			Angry: f.Emotions[2],
+			Disgusted: f.Emotions[3],
+			Afraid: f.Emotions[4],
+			Sad: f.Emotions[5],
+		},
+	}, nil
+}
+
+func required(field string, present bool) error {
+	if !present {
+		return errors.New(fmt.Sprintf("missing field %s", field))
+	}
+
+	return nil
+}
+
+func minLength(field string, values []float64, length int) error {
+	if len(values) < length {
+		return errors.New(fmt.Sprintf("field %s must have at least %d values but has %d", field, length, len(values)))
+	}
+
+	return nil
+}
+
+func errorFold(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
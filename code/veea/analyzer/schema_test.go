@@ -0,0 +1,80 @@
+package analyzer
+
+import "testing"
+
+const validFaceV1 = `{"gender": "male", "age": 31.6, "mood": 0.4, "headpose": [1, 2, 3, 0.1, 0.2, 0.3], "headgaze": [10, -5], "emotions": [0.5, 0.1, 0.05, 0.02, 0.01, 0.03]}`
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		err      bool
+		reply    bool
+		version  int
+		faces    int
+		failures []int
+	}{
+		{"bare list", `[` + validFaceV1 + `]`, false, false, 1, 1, nil},
+		{"empty list", `[]`, false, false, 1, 0, nil},
+		{"envelope", `{"version": 1, "faces": [` + validFaceV1 + `, ` + validFaceV1 + `]}`, false, false, 1, 2, nil},
+		{"missing field", `[` + validFaceV1 + `, {"gender": "female", "mood": 0.1, "headpose": [1, 2, 3, 4, 5, 6], "headgaze": [1, 2], "emotions": [1, 2, 3, 4, 5, 6]}]`, false, false, 1, 1, []int{1}},
+		{"short headpose", `[{"gender": "female", "age": 20, "mood": 0.1, "headpose": [1, 2, 3], "headgaze": [1, 2], "emotions": [1, 2, 3, 4, 5, 6]}]`, false, false, 1, 0, []int{0}},
+		{"malformed face", `[` + validFaceV1 + `, "face"]`, false, false, 1, 1, []int{1}},
+		{"unsupported version", `{"version": 7, "faces": []}`, true, false, 0, 0, nil},
+		{"error reply", `{"error": "no image"}`, true, true, 0, 0, nil},
+		{"not json", `faces`, true, false, 0, 0, nil},
+	}
+
+	for _, test := range tests {
+		result, err := Decode([]byte(test.body))
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.name)
+				continue
+			}
+			if _, ok := err.(*ReplyError); ok != test.reply {
+				t.Errorf("%s: reply error = %v, want %v", test.name, ok, test.reply)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+
+		if result.Version != test.version {
+			t.Errorf("%s: version = %d, want %d", test.name, result.Version, test.version)
+		}
+		if len(result.Faces) != test.faces {
+			t.Errorf("%s: %d faces, want %d", test.name, len(result.Faces), test.faces)
+		}
+		if len(result.Failures) != len(test.failures) {
+			t.Errorf("%s: %d failures, want %d", test.name, len(result.Failures), len(test.failures))
+			continue
+		}
+		for idx, failure := range result.Failures {
+			if failure.Index != test.failures[idx] || failure.Reason == "" {
+				t.Errorf("%s: failure %d = %+v, want index %d with a reason", test.name, idx, failure, test.failures[idx])
+			}
+		}
+	}
+}
+
+func TestDecodeFaceV1(t *testing.T) {
+	face, err := decodeFaceV1([]byte(validFaceV1))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := Face{
+		Gender: "male",
+		Age: 31,
+		Mood: 0.4,
+		HeadPose: HeadPose{X: 1, Y: 2, Z: 3, Yaw: 0.1, Pitch: 0.2, Roll: 0.3},
+		HeadGaze: HeadGaze{X: 10, Y: -5},
+		Emotions: Emotions{Happy: 0.5, Surprised: 0.1, Angry: 0.05, Disgusted: 0.02, Afraid: 0.01, Sad: 0.03},
+	}
+	if *face != want {
+		t.Errorf("face = %+v, want %+v", *face, want)
+	}
+}
@@ -0,0 +1,40 @@
+package analyzer
+
+// analyzer that never leaves the process and always answers with the same
+// faces, used for tests and machines without access to the analyzer service
+type StubAnalyzer struct {
+	Faces []*Face
+}
+
+func NewStubAnalyzer() *StubAnalyzer {
+	return &StubAnalyzer{
+		Faces: []*Face{
+			{
+				Gender: "female",
+				Age: 27,
+				Mood: 0.6,
+				HeadPose: HeadPose{X: 0, Y: 0, Z: 60, Yaw: 0.02, Pitch: -0.03, Roll: 0.01},
+				HeadGaze: HeadGaze{X: 12, Y: -8},
+				Emotions: Emotions{Happy: 0.55, Surprised: 0.1, Angry: 0.02, Disgusted: 0.01, Afraid: 0.02, Sad: 0.05},
+			},
+		},
+	}
+}
+
+func (sa *StubAnalyzer) Version() string {
+	return "stub-1"
+}
+
+func (sa *StubAnalyzer) Analyze(image []byte) (*Result, error) {
+	if len(image) == 0 {
+		return nil, &ReplyError{Reply: map[string]interface{}{"error": "empty image"}}
+	}
+
+	result := &Result{Version: SchemaVersion}
+	for _, face := range sa.Faces {
+		copied := *face
+		result.Faces = append(result.Faces, &copied)
+	}
+
+	return result, nil
+}
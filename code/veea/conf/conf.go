@@ -14,8 +14,142 @@ const (
 
 	// time after which a view expires (in seconds)
 	ViewExpireTime int64 = 5 * 60 * 60
+	// time (in seconds) without samples or events after the video ended at
+	// which a view is finalized before it expires
+	ViewEndGraceTime int64 = 10 * 60
+	// number of views finalized per query
+	ViewFinalizeBatchSize = 100
+	// interval (in seconds) at which views that are due are finalized
+	ViewFinalizeInterval int64 = 10
+	// time (in seconds) an ended view keeps taking the samples and events
+	// still on their way before it is finalized
+	ViewEndSettleTime int64 = 5
+	// interval (in seconds) at which players send heartbeats, and the time
+	// without one after which a started view is taken as abandoned (hidden
+	// tabs only run their timers about once a minute)
+	ViewHeartbeatInterval int64 = 15
+	ViewHeartbeatTimeout int64 = 2 * 60
 	// length of the view id
 	ViewIdLength = 64
 
+	// address of the face analyzer service
+	AnalyzerUrl = "http://52.77.220.121:9999"
+	// version of the model behind the analyzer service, stored with every stats row
+	AnalyzerVersion = "crowdsight-1"
+	// time after which a single analyzer request is abandoned (in seconds)
+	AnalyzerTimeout int64 = 10
+	// number of times a request that failed with a network or server error is
+	// retried, and the backoff (in milliseconds) before the first retry, it
+	// doubles for every further one and is jittered
+	AnalyzerRetries = 2
+	AnalyzerRetryBackoff int64 = 500
+	// number of consecutive failed requests after which the analyzer is taken
+	// as down, and the time (in seconds) no requests are made to it then
+	AnalyzerBreakerFailures = 5
+	AnalyzerBreakerCooldown int64 = 30
+	// token sent as a bearer token to the analyzer service (empty to send none)
+	AnalyzerAuthToken = ""
+	// use the local stub analyzer instead of the analyzer service
+	AnalyzerStub = false
+
+	// number of workers analyzing submitted frames concurrently
+	IngestWorkers = 8
+	// number of frames waiting for a worker after which new frames are dropped
+	IngestQueueSize = 256
+	// maximum number of frames in a single batch upload
+	BatchMaxFrames = 100
+	// maximum size of a single frame upload (in bytes)
+	MaxFrameSize int64 = 8 * 1024 * 1024
+	// frames with more pixels (width x height) are rejected without being
+	// decoded, a small compressed image can decode to a huge one
+	FrameMaxPixels = 4096 * 2160
+	// slack (in seconds) allowed by the plausibility checks of submitted sample times
+	PlausibilityTolerance = 5.0
+	// fastest playback rate a sample can plausibly advance at without a seek
+	PlausibilityMaxRate = 2.0
+
+	// a sample flagged for a jump is cleared when a seek arrives that the
+	// player recorded at most this many seconds before the sample was captured
+	// (the longest time between two frames plus slack)
+	PlausibilitySeekWindow int64 = 15
+
+	// frames per second a single view can submit on average and at once (a
+	// batch upload counts every frame, so the burst must fit a full batch)
+	RateLimitViewRate = 1.0
+	RateLimitViewBurst = 100.0
+	// frames per second all the views of a user can submit on average and at once
+	RateLimitUserRate = 2.0
+	RateLimitUserBurst = 200.0
+	// share the rate limits of all the instances through the database
+	RateLimitShared = false
+
+	// interval (in milliseconds) at which players on the stream capture frames
+	// while the ingestion queue is idle, and the longest one they are told to
+	// slow down to when it fills up
+	StreamFrameInterval int64 = 1500
+	StreamMaxFrameInterval int64 = 10000
+
+	// reject frames before analysis that are smaller than QualityMinWidth x
+	// QualityMinHeight pixels, whose mean luminance (0-255) is outside
+	// QualityMinBrightness - QualityMaxBrightness, whose luminance deviates
+	// less than QualityMinContrast or whose laplacian varies less than
+	// QualityMinSharpness (blurry)
+	QualityGating = true
+	QualityMinWidth = 64
+	QualityMinHeight = 48
+	QualityMinBrightness = 25.0
+	QualityMaxBrightness = 235.0
+	QualityMinContrast = 8.0
+	QualityMinSharpness = 10.0
+
+	// reuse the analysis of the previous frame of a view for a frame with the
+	// same image instead of analyzing it again
+	FrameReuse = true
+	// also compare frames by their perceptual hash, frames whose hashes differ
+	// in at most FrameReuseMaxDistance of 64 bits are taken as the same
+	FramePerceptualHash = true
+	FrameReuseMaxDistance = 3
+	// number of frames that can reuse the analysis of one analyzed frame, the
+	// next one is analyzed again even if it looks the same
+	FrameReuseMaxCount = 20
+
+	// maximum number of player events in a single upload
+	EventsMaxBatch = 200
+
+	// maximum number of player events stored for a single view, later uploads
+	// of the view are rejected
+	ViewMaxEvents = 5000
+
+	// maximum distance between the head positions of a face and a person seen
+	// earlier in the view (in the analyzer's units) for the face to be that person
+	TrackMaxDistance = 25.0
+	// distance added per year of age difference when matching a face to a person
+	TrackAgeWeight = 0.5
+	// distance added when a face and a person have opposite genders
+	TrackGenderPenalty = 15.0
+
+	// number of view times before a frame whose faces it is matched against,
+	// a person not seen in them gets a new index
+	PersonTrackViewTimes = 20
+
+	// file defining engagement models next to the built in ones, their weights
+	// can be changed there without a rebuild (under a new model id)
+	EngagementModelsFile = BasePath + "engagement_models.json"
+
+	// number of stats rows rescored in a single transaction of an engagement job
+	EngagementChunkSize = 500
+
+	// number of times in a row a chunk of an engagement job is tried before
+	// the job is marked failed
+	EngagementChunkMaxAttempts = 5
+
+	// directory in which frames of archived videos are stored (empty to disable archiving)
+	FrameStoreDir = "/var/lib/veea/frames"
+	// number of expired frame rows purged per transaction
+	FramePurgeBatchSize = 500
+	// interval (in seconds) at which the whole frame store is walked for the
+	// frames of deleted views, expired frames are purged without walking it
+	FrameSweepInterval int64 = 24 * 60 * 60
+
 	BasePath = "/home/garvit/cs/go/work/src/github.com/gpahal/veea/"
 )
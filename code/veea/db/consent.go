@@ -0,0 +1,103 @@
+package db
+
+import (
+	"time"
+	"errors"
+)
+
+// ConsentText is a published version of the text participants agree to before
+// their webcam is captured. Texts are never edited, a change is published as
+// a new version which everyone has to accept again.
+type ConsentText struct {
+	Version   int64
+	Body      string
+	CreatedAt time.Time
+}
+
+// GetCurrentConsentText returns the latest published consent text
+func GetCurrentConsentText() (*ConsentText, error) {
+	rows, err := query("SELECT version, body, created_at FROM consent_text ORDER BY version DESC LIMIT 1")
+	if err != nil {
+		return nil, &InternalError{error: err}
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		var consentText ConsentText
+		err = rows.Scan(&consentText.Version, &consentText.Body, &consentText.CreatedAt)
+		if err != nil {
+			return nil, &InternalError{error: err}
+		}
+
+		return &consentText, nil
+	}
+
+	return nil, &UserError{error: errors.New("No consent text has been published")}
+}
+
+// GetConsentId returns the id of the acceptance of a consent text version by a
+// user, found is false if the user hasn't accepted it
+func GetConsentId(userId int64, version int64) (int64, bool, error) {
+	rows, err := query("SELECT id FROM consent WHERE user_id = ? AND version = ? LIMIT 1", userId, version)
+	if err != nil {
+		return 0, false, &InternalError{error: err}
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		var id int64
+		err = rows.Scan(&id)
+		if err != nil {
+			return 0, false, &InternalError{error: err}
+		}
+
+		return id, true, nil
+	}
+
+	return 0, false, nil
+}
+
+// AcceptConsent records that a user accepted a consent text version, only the
+// current version can be accepted
+func AcceptConsent(userId int64, version int64) (int64, error) {
+	consentText, err := GetCurrentConsentText()
+	if err != nil {
+		return 0, err
+	}
+
+	err = errorFold(
+		UserIdExists(userId),
+		validateConsentVersion(consentText, version),
+	)
+	if err != nil {
+		return 0, &UserError{error: err}
+	}
+
+	_, err = exec("INSERT INTO consent (user_id, version) VALUES (?, ?) ON DUPLICATE KEY UPDATE id = id", userId, version)
+	if err != nil {
+		return 0, &InternalError{error: err}
+	}
+
+	id, found, err := GetConsentId(userId, version)
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		return 0, &InternalError{error: errors.New("Accept consent failed")}
+	}
+
+	return id, nil
+}
+
+func consentIdOfUser(userId int64, consentId int64) error {
+	rows, err := query("SELECT * FROM consent WHERE id = ? AND user_id = ?", consentId, userId)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		return nil
+	}
+	return errors.New("Consent does not exist")
+}
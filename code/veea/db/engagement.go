@@ -0,0 +1,318 @@
+package db
+
+import (
+	"time"
+	"errors"
+	"database/sql"
+)
+
+type EngagementJob struct {
+	Id              int64
+	VideoId         string
+	EngagementModel string
+	Status          int
+	LastStatsId     int64
+	Processed       int64
+	Total           int64
+	Error           string
+	CreatedAt       time.Time
+}
+
+// status of an engagement job
+const (
+	EngagementJobPending = 0
+	EngagementJobRunning = 1
+	EngagementJobDone = 2
+	EngagementJobFailed = 3
+)
+
+// time for which a claimed job belongs to one process, a job whose process
+// died becomes claimable again once it passes
+const engagementJobLease = 2 * time.Minute
+
+// ErrEngagementJobLeaseLost is returned for a chunk of a job whose lease
+// expired and may have been claimed by another process
+var ErrEngagementJobLeaseLost = errors.New("Engagement job lease was lost")
+
+// CreateEngagementJob queues the rescoring of a video (or every video if
+// videoId is empty) with the given engagement model
+func CreateEngagementJob(videoId string, engagementModel string) (int64, error) {
+	var videoIdValue interface{}
+
+	if videoId != "" {
+		err := errorFold(
+			VideoIdExists(videoId),
+		)
+		if err != nil {
+			return 0, &UserError{error: err}
+		}
+		videoIdValue = videoId
+	}
+
+	total, err := countEngagementJobRows(videoId)
+	if err != nil {
+		return 0, &InternalError{error: err}
+	}
+
+	res, err := exec("INSERT INTO engagement_job (video_id, engagement_model, total) VALUES (?, ?, ?)", videoIdValue, engagementModel, total)
+	if err != nil {
+		return 0, &InternalError{error: err}
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, &InternalError{error: err}
+	}
+
+	return id, nil
+}
+
+func countEngagementJobRows(videoId string) (int64, error) {
+	var rows *sql.Rows
+	var err error
+
+	if videoId == "" {
+		rows, err = query("SELECT COUNT(*) FROM video_view_stats")
+	} else {
+		rows, err = query("SELECT COUNT(*) FROM video_view_stats AS S, video_view_time AS T, video_view AS V WHERE S.view_time_id = T.id AND T.view_id = V.view_id AND V.video_id = ?", videoId)
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var count int64
+	if rows.Next() {
+		err = rows.Scan(&count)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return count, nil
+}
+
+func GetEngagementJob(id int64) (*EngagementJob, error) {
+	rows, err := query("SELECT id, video_id, engagement_model, status, last_stats_id, processed, total, error, created_at FROM engagement_job WHERE id = ? LIMIT 1", id)
+	if err != nil {
+		return nil, &InternalError{error: err}
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		return scanEngagementJob(rows)
+	}
+
+	return nil, &UserError{error: errors.New("Engagement job does not exist")}
+}
+
+// GetRunnableEngagementJobIds returns the jobs that are pending or whose
+// process stopped renewing its lease
+func GetRunnableEngagementJobIds() ([]int64, error) {
+	rows, err := query("SELECT id FROM engagement_job WHERE status = ? OR (status = ? AND locked_until < ?) ORDER BY id", EngagementJobPending, EngagementJobRunning, time.Now())
+	if err != nil {
+		return nil, &InternalError{error: err}
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+
+	for rows.Next() {
+		var id int64
+		err = rows.Scan(&id)
+
+		if err != nil {
+			return nil, &InternalError{error: err}
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// ClaimEngagementJob takes the lease of a runnable job, it returns false if
+// another process holds it or the job is already finished
+func ClaimEngagementJob(id int64) (bool, error) {
+	now := time.Now()
+
+	res, err := exec("UPDATE engagement_job SET status = ?, locked_until = ? WHERE id = ? AND (status = ? OR (status = ? AND locked_until < ?))",
+		EngagementJobRunning, now.Add(engagementJobLease), id, EngagementJobPending, EngagementJobRunning, now)
+	if err != nil {
+		return false, &InternalError{error: err}
+	}
+
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return false, &InternalError{error: err}
+	}
+
+	return ra > 0, nil
+}
+
+// RescoreEngagementChunk rescores the next chunk of stats rows of a claimed
+// job and advances its cursor in the same transaction, so an interrupted job
+// resumes right after the last committed chunk. It returns the number of
+// rescored rows, 0 once the job has no rows left. The job row stays locked
+// until the chunk commits, so the lease can't pass to another process while
+// the cursor is advanced.
+func RescoreEngagementChunk(job *EngagementJob, chunkSize int, score func(viewStats *ViewStats) float64) (int, error) {
+	tx, err := transaction()
+	if err != nil {
+		return 0, &InternalError{error: err}
+	}
+
+	rows, err := tx.Query("SELECT id FROM engagement_job WHERE id = ? AND status = ? AND locked_until >= ? FOR UPDATE", job.Id, EngagementJobRunning, time.Now())
+	if err != nil {
+		tx.Rollback()
+		return 0, &InternalError{error: err}
+	}
+	leased := rows.Next()
+	rows.Close()
+	if !leased {
+		tx.Rollback()
+		return 0, ErrEngagementJobLeaseLost
+	}
+
+	columns := "S.id, S.mood, S.head_yaw, S.head_pitch, S.head_roll, S.head_gaze_x, S.head_gaze_y, S.happy, S.surprised, S.angry, S.disgusted, S.afraid, S.sad"
+
+	if job.VideoId == "" {
+		rows, err = tx.Query("SELECT " + columns + " FROM video_view_stats AS S WHERE S.id > ? ORDER BY S.id LIMIT ? FOR UPDATE", job.LastStatsId, chunkSize)
+	} else {
+		rows, err = tx.Query("SELECT " + columns + " FROM video_view_stats AS S, video_view_time AS T, video_view AS V WHERE S.view_time_id = T.id AND T.view_id = V.view_id AND V.video_id = ? AND S.id > ? ORDER BY S.id LIMIT ? FOR UPDATE", job.VideoId, job.LastStatsId, chunkSize)
+	}
+	if err != nil {
+		tx.Rollback()
+		return 0, &InternalError{error: err}
+	}
+
+	ids := []int64{}
+	viewStatsList := []*ViewStats{}
+
+	for rows.Next() {
+		var id int64
+		var viewStats ViewStats
+		err = rows.Scan(
+			&id,
+			&viewStats.Mood,
+			&viewStats.HeadYaw,
+			&viewStats.HeadPitch,
+			&viewStats.HeadRoll,
+			&viewStats.HeadGazeX,
+			&viewStats.HeadGazeY,
+			&viewStats.Happy,
+			&viewStats.Surprised,
+			&viewStats.Angry,
+			&viewStats.Disgusted,
+			&viewStats.Afraid,
+			&viewStats.Sad,
+		)
+
+		if err != nil {
+			rows.Close()
+			tx.Rollback()
+			return 0, &InternalError{error: err}
+		}
+
+		ids = append(ids, id)
+		viewStatsList = append(viewStatsList, &viewStats)
+	}
+	rows.Close()
+
+	for idx, viewStats := range viewStatsList {
+		_, err = tx.Exec("UPDATE video_view_stats SET engagement = ?, engagement_model = ? WHERE id = ?", score(viewStats), job.EngagementModel, ids[idx])
+		if err != nil {
+			tx.Rollback()
+			return 0, &InternalError{error: err}
+		}
+	}
+
+	if len(ids) > 0 {
+		job.LastStatsId = ids[len(ids) - 1]
+		job.Processed += int64(len(ids))
+	}
+
+	_, err = tx.Exec("UPDATE engagement_job SET last_stats_id = ?, processed = ?, attempts = 0, locked_until = ? WHERE id = ?", job.LastStatsId, job.Processed, time.Now().Add(engagementJobLease), job.Id)
+	if err != nil {
+		tx.Rollback()
+		return 0, &InternalError{error: err}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, &InternalError{error: err}
+	}
+
+	return len(ids), nil
+}
+
+// FailEngagementChunk counts a failed attempt at the next chunk of a job and
+// returns the number of attempts since the last committed chunk
+func FailEngagementChunk(id int64) (int, error) {
+	tx, err := transaction()
+	if err != nil {
+		return 0, &InternalError{error: err}
+	}
+
+	_, err = tx.Exec("UPDATE engagement_job SET attempts = attempts + 1 WHERE id = ?", id)
+	if err != nil {
+		tx.Rollback()
+		return 0, &InternalError{error: err}
+	}
+
+	var attempts int
+	err = tx.QueryRow("SELECT attempts FROM engagement_job WHERE id = ?", id).Scan(&attempts)
+	if err != nil {
+		tx.Rollback()
+		return 0, &InternalError{error: err}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, &InternalError{error: err}
+	}
+
+	return attempts, nil
+}
+
+func FinishEngagementJob(id int64, jobErr error) error {
+	status := EngagementJobDone
+	var errorString interface{}
+	if jobErr != nil {
+		status = EngagementJobFailed
+		errorString = truncate(jobErr.Error(), 255)
+	}
+
+	_, err := exec("UPDATE engagement_job SET status = ?, error = ?, locked_until = NULL WHERE id = ?", status, errorString, id)
+	if err != nil {
+		return &InternalError{error: err}
+	}
+
+	return nil
+}
+
+func scanEngagementJob(rows *sql.Rows) (*EngagementJob, error) {
+	var job EngagementJob
+	var videoId sql.NullString
+	var errorString sql.NullString
+
+	err := rows.Scan(
+		&job.Id,
+		&videoId,
+		&job.EngagementModel,
+		&job.Status,
+		&job.LastStatsId,
+		&job.Processed,
+		&job.Total,
+		&errorString,
+		&job.CreatedAt,
+	)
+	if err != nil {
+		return nil, &InternalError{error: err}
+	}
+
+	job.VideoId = videoId.String
+	job.Error = errorString.String
+
+	return &job, nil
+}
@@ -0,0 +1,137 @@
+package db
+
+import (
+	"fmt"
+	"time"
+	"errors"
+
+	"github.com/gpahal/veea/conf"
+)
+
+// player event types
+const (
+	ViewEventPlay = "play"
+	ViewEventPause = "pause"
+	ViewEventSeek = "seek"
+	ViewEventBuffering = "buffering"
+	ViewEventQuality = "quality"
+	ViewEventRate = "rate"
+	ViewEventEnd = "end"
+)
+
+// ViewEvent is a single player event of a view. ClientTime is the wall clock
+// time of the event on the client in milliseconds since the epoch, From and To
+// are only set for seeks, Quality for quality changes and Rate for rate
+// changes. CreatedAt is the time the server received it, it is only read.
+type ViewEvent struct {
+	Type       string
+	VideoTime  float64
+	ClientTime int64
+	From       float64
+	To         float64
+	Quality    string
+	Rate       float64
+	CreatedAt  time.Time
+}
+
+func AddViewEvents(userId int64, videoId string, viewId string, viewEvents []*ViewEvent) error {
+	validationErrs := []error{ViewIdNotExpiredExists(videoId, viewId), ViewIdOfUser(viewId, userId)}
+	for idx, viewEvent := range viewEvents {
+		validationErrs = append(validationErrs, validateViewEvent(idx, viewEvent))
+	}
+
+	err := errorFold(validationErrs...)
+	if err != nil {
+		return &UserError{error: err}
+	}
+
+	tx, err := transaction()
+	if err != nil {
+		return &InternalError{error: err}
+	}
+
+	// the view is locked so that concurrent uploads can't pass the cap together
+	rows, err := tx.Query("SELECT view_id FROM video_view WHERE view_id = ? FOR UPDATE", viewId)
+	if err != nil {
+		tx.Rollback()
+		return &InternalError{error: err}
+	}
+	rows.Close()
+
+	var count int
+	err = tx.QueryRow("SELECT COUNT(*) FROM video_view_event WHERE view_id = ?", viewId).Scan(&count)
+	if err != nil {
+		tx.Rollback()
+		return &InternalError{error: err}
+	}
+	if count + len(viewEvents) > conf.ViewMaxEvents {
+		tx.Rollback()
+		return &UserError{error: errors.New(fmt.Sprintf("A view can have %d or less events", conf.ViewMaxEvents))}
+	}
+
+	for _, viewEvent := range viewEvents {
+		var from, to, quality, rate interface{}
+		switch viewEvent.Type {
+		case ViewEventSeek:
+			from = viewEvent.From
+			to = viewEvent.To
+		case ViewEventQuality:
+			quality = viewEvent.Quality
+		case ViewEventRate:
+			rate = viewEvent.Rate
+		}
+
+		_, err = tx.Exec("INSERT INTO video_view_event (view_id, type, video_time, client_time, from_time, to_time, quality, rate) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+			viewId, viewEvent.Type, viewEvent.VideoTime, viewEvent.ClientTime, from, to, quality, rate)
+		if err != nil {
+			tx.Rollback()
+			return &InternalError{error: err}
+		}
+
+		if viewEvent.Type == ViewEventSeek {
+			err = unflagSeekedViewTimes(tx, viewId, viewEvent.ClientTime)
+			if err != nil {
+				tx.Rollback()
+				return &InternalError{error: err}
+			}
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return &InternalError{error: err}
+	}
+
+	return nil
+}
+
+func validateViewEvent(idx int, viewEvent *ViewEvent) error {
+	if viewEvent == nil {
+		return errors.New(fmt.Sprintf("Event %d is empty", idx))
+	}
+	if viewEvent.VideoTime < 0 || viewEvent.ClientTime <= 0 {
+		return errors.New(fmt.Sprintf("Event %d must have a video time and a client time", idx))
+	}
+
+	switch viewEvent.Type {
+	case ViewEventPlay, ViewEventPause, ViewEventBuffering, ViewEventEnd:
+		return nil
+	case ViewEventSeek:
+		if viewEvent.From < 0 || viewEvent.To < 0 {
+			return errors.New(fmt.Sprintf("Seek event %d must have non negative from and to times", idx))
+		}
+		return nil
+	case ViewEventQuality:
+		if viewEvent.Quality == "" || len(viewEvent.Quality) > 20 {
+			return errors.New(fmt.Sprintf("Quality event %d must have a quality of 20 or less characters", idx))
+		}
+		return nil
+	case ViewEventRate:
+		if viewEvent.Rate <= 0 {
+			return errors.New(fmt.Sprintf("Rate event %d must have a positive rate", idx))
+		}
+		return nil
+	default:
+		return errors.New(fmt.Sprintf("Event %d has an unknown type", idx))
+	}
+}
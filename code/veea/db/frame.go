@@ -0,0 +1,191 @@
+package db
+
+import (
+	"time"
+	"errors"
+	"strings"
+
+	"github.com/gpahal/veea/conf"
+)
+
+func AddViewFrame(viewTimeId int64, hash string) error {
+	err := errorFold(
+		ViewTimeIdExists(viewTimeId),
+	)
+	if err != nil {
+		return &UserError{error: err}
+	}
+
+	_, err = exec("INSERT INTO video_view_frame (view_time_id, hash) VALUES (?, ?) ON DUPLICATE KEY UPDATE hash = VALUES(hash)", viewTimeId, hash)
+	if err != nil {
+		return &InternalError{error: err}
+	}
+
+	return nil
+}
+
+func GetViewFrameHash(viewTimeId int64) (string, error) {
+	rows, err := query("SELECT hash FROM video_view_frame WHERE view_time_id = ? LIMIT 1", viewTimeId)
+	if err != nil {
+		return "", &InternalError{error: err}
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		var hash string
+		err = rows.Scan(&hash)
+
+		if err != nil {
+			return "", &InternalError{error: err}
+		}
+
+		return hash, nil
+	}
+
+	return "", &UserError{error: errors.New("View frame does not exist")}
+}
+
+// FrameHashesReferenced returns which of the hashes are still referenced by a
+// frame row
+func FrameHashesReferenced(hashes []string) (map[string]bool, error) {
+	referenced := make(map[string]bool)
+	if len(hashes) == 0 {
+		return referenced, nil
+	}
+
+	args := make([]interface{}, 0, len(hashes))
+	for _, hash := range hashes {
+		args = append(args, hash)
+	}
+
+	rows, err := query("SELECT DISTINCT hash FROM video_view_frame WHERE hash IN (?" + strings.Repeat(", ?", len(hashes) - 1) + ")", args...)
+	if err != nil {
+		return nil, &InternalError{error: err}
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var hash string
+		err = rows.Scan(&hash)
+
+		if err != nil {
+			return nil, &InternalError{error: err}
+		}
+
+		referenced[hash] = true
+	}
+
+	return referenced, nil
+}
+
+// DeleteExpiredViewFrames removes up to conf.FramePurgeBatchSize frame rows
+// that are older than the retention period of their video and returns their
+// hashes, the files of those no other row references can then be removed
+func DeleteExpiredViewFrames() ([]string, error) {
+	tx, err := transaction()
+	if err != nil {
+		return nil, &InternalError{error: err}
+	}
+
+	rows, err := tx.Query("SELECT F.view_time_id, F.hash FROM video_view_frame AS F, video_view_time AS T, video_view AS V, video AS W WHERE F.view_time_id = T.id AND T.view_id = V.view_id AND V.video_id = W.video_id AND W.frame_retention_days > 0 AND F.created_at < DATE_SUB(NOW(), INTERVAL W.frame_retention_days DAY) LIMIT ? FOR UPDATE", conf.FramePurgeBatchSize)
+	if err != nil {
+		tx.Rollback()
+		return nil, &InternalError{error: err}
+	}
+
+	viewTimeIds := []interface{}{}
+	hashes := []string{}
+	for rows.Next() {
+		var viewTimeId int64
+		var hash string
+		err = rows.Scan(&viewTimeId, &hash)
+
+		if err != nil {
+			rows.Close()
+			tx.Rollback()
+			return nil, &InternalError{error: err}
+		}
+
+		viewTimeIds = append(viewTimeIds, viewTimeId)
+		hashes = append(hashes, hash)
+	}
+	rows.Close()
+
+	if len(viewTimeIds) == 0 {
+		tx.Rollback()
+		return hashes, nil
+	}
+
+	_, err = tx.Exec("DELETE FROM video_view_frame WHERE view_time_id IN (?" + strings.Repeat(", ?", len(viewTimeIds) - 1) + ")", viewTimeIds...)
+	if err != nil {
+		tx.Rollback()
+		return nil, &InternalError{error: err}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, &InternalError{error: err}
+	}
+
+	return hashes, nil
+}
+
+type ViewTimeFilter struct {
+	VideoId string
+	ViewId  string
+	From    time.Time
+	To      time.Time
+}
+
+type ViewFrame struct {
+	VideoId    string
+	ViewTimeId int64
+	Hash       string
+}
+
+func GetViewFrames(filter *ViewTimeFilter) ([]*ViewFrame, error) {
+	conditions := []string{"F.view_time_id = T.id", "T.view_id = V.view_id"}
+	args := []interface{}{}
+
+	if filter.VideoId != "" {
+		conditions = append(conditions, "V.video_id = ?")
+		args = append(args, filter.VideoId)
+	}
+	if filter.ViewId != "" {
+		conditions = append(conditions, "V.view_id = ?")
+		args = append(args, filter.ViewId)
+	}
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "T.created_at >= ?")
+		args = append(args, filter.From)
+	}
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "T.created_at < ?")
+		args = append(args, filter.To)
+	}
+
+	rows, err := query("SELECT V.video_id, F.view_time_id, F.hash FROM video_view_frame AS F, video_view_time AS T, video_view AS V WHERE " + strings.Join(conditions, " AND ") + " ORDER BY F.view_time_id", args...)
+	if err != nil {
+		return nil, &InternalError{error: err}
+	}
+	defer rows.Close()
+
+	viewFrames := []*ViewFrame{}
+
+	for rows.Next() {
+		var viewFrame ViewFrame
+		err = rows.Scan(
+			&viewFrame.VideoId,
+			&viewFrame.ViewTimeId,
+			&viewFrame.Hash,
+		)
+
+		if err != nil {
+			return nil, &InternalError{error: err}
+		}
+
+		viewFrames = append(viewFrames, &viewFrame)
+	}
+
+	return viewFrames, nil
+}
@@ -0,0 +1,217 @@
+package db
+
+import (
+	"fmt"
+	"time"
+	"errors"
+	"database/sql"
+
+	"github.com/gpahal/veea/conf"
+)
+
+// A view is open while it takes samples and events, from the time the player
+// starts it it also sends heartbeats. It is finalized once the player ended
+// it (ViewEndSettleTime after), once its heartbeats stopped coming for
+// ViewHeartbeatTimeout (abandoned), once it expired, or for players that
+// don't send heartbeats once the video ended and nothing came for
+// ViewEndGraceTime. Its timeline and watch time are built a last time when it
+// is finalized and never again after.
+
+// reason a view ended for
+const (
+	ViewEndEnded = "ended"
+	ViewEndUnload = "unload"
+	ViewEndAbandoned = "abandoned"
+	ViewEndExpired = "expired"
+)
+
+// StartView marks a view started by its player, heartbeats are expected from
+// then on
+func StartView(userId int64, videoId string, viewId string) error {
+	err := errorFold(
+		ViewIdNotExpiredExists(videoId, viewId),
+		ViewIdOfUser(viewId, userId),
+	)
+	if err != nil {
+		return &UserError{error: err}
+	}
+
+	now := time.Now()
+	_, err = exec("UPDATE video_view SET started_at = IFNULL(started_at, ?), last_heartbeat_at = ? WHERE view_id = ? AND ended_at IS NULL", now, now, viewId)
+	if err != nil {
+		return &InternalError{error: err}
+	}
+
+	return nil
+}
+
+func HeartbeatView(userId int64, videoId string, viewId string) error {
+	err := errorFold(
+		ViewIdNotExpiredExists(videoId, viewId),
+		ViewIdOfUser(viewId, userId),
+	)
+	if err != nil {
+		return &UserError{error: err}
+	}
+
+	_, err = exec("UPDATE video_view SET last_heartbeat_at = ? WHERE view_id = ? AND ended_at IS NULL", time.Now(), viewId)
+	if err != nil {
+		return &InternalError{error: err}
+	}
+
+	return nil
+}
+
+// EndView marks a view ended by its player, it is finalized shortly after. A
+// view is only ended once, the first reason is kept.
+func EndView(userId int64, videoId string, viewId string, reason string) error {
+	err := errorFold(
+		ViewIdNotExpiredExists(videoId, viewId),
+		ViewIdOfUser(viewId, userId),
+		validateEndReason(reason),
+	)
+	if err != nil {
+		return &UserError{error: err}
+	}
+
+	_, err = exec("UPDATE video_view SET ended_at = ?, end_reason = ? WHERE view_id = ? AND ended_at IS NULL", time.Now(), reason, viewId)
+	if err != nil {
+		return &InternalError{error: err}
+	}
+
+	return nil
+}
+
+// players only end a view when the video ended or the page is left
+func validateEndReason(reason string) error {
+	if reason != ViewEndEnded && reason != ViewEndUnload {
+		return errors.New(fmt.Sprintf("End reason must be %s or %s", ViewEndEnded, ViewEndUnload))
+	}
+
+	return nil
+}
+
+// GetDueViewIds returns up to conf.ViewFinalizeBatchSize open views that are
+// due to be finalized, oldest first
+func GetDueViewIds() ([]string, error) {
+	now := time.Now().Unix()
+	expiredBefore := time.Unix(now - conf.ViewExpireTime, 0)
+	endedBefore := time.Unix(now - conf.ViewEndSettleTime, 0)
+	heartbeatBefore := time.Unix(now - conf.ViewHeartbeatTimeout, 0)
+	idleSince := time.Unix(now - conf.ViewEndGraceTime, 0)
+
+	rows, err := query("SELECT V.view_id FROM video_view AS V WHERE V.finalized_at IS NULL AND (V.created_at < ? OR V.ended_at < ? OR (V.ended_at IS NULL AND V.last_heartbeat_at < ?) OR (V.last_heartbeat_at IS NULL AND EXISTS (SELECT 1 FROM video_view_event AS E WHERE E.view_id = V.view_id AND E.type = ?) AND NOT EXISTS (SELECT 1 FROM video_view_event AS E WHERE E.view_id = V.view_id AND E.created_at >= ?) AND NOT EXISTS (SELECT 1 FROM video_view_time AS T WHERE T.view_id = V.view_id AND T.created_at >= ?))) ORDER BY V.created_at LIMIT ?",
+		expiredBefore, endedBefore, heartbeatBefore, ViewEventEnd, idleSince, idleSince, conf.ViewFinalizeBatchSize)
+	if err != nil {
+		return nil, &InternalError{error: err}
+	}
+	defer rows.Close()
+
+	viewIds := []string{}
+
+	for rows.Next() {
+		var viewId string
+		err = rows.Scan(&viewId)
+
+		if err != nil {
+			return nil, &InternalError{error: err}
+		}
+
+		viewIds = append(viewIds, viewId)
+	}
+
+	return viewIds, nil
+}
+
+// FinalizeView stores the last timeline and watch time of a view and closes
+// it. It returns false if the view was already finalized, by another instance
+// for example, in which case nothing is changed. The view is locked the same
+// way as by ReplaceViewSegments, so a timeline update running at the same time
+// either commits before it or leaves the final timeline alone.
+func FinalizeView(viewId string, segments []*ViewSegment, watchTime float64, builtAt time.Time) (bool, error) {
+	tx, err := transaction()
+	if err != nil {
+		return false, &InternalError{error: err}
+	}
+
+	open, err := lockOpenView(tx, viewId)
+	if err != nil || !open {
+		tx.Rollback()
+		return false, err
+	}
+
+	err = replaceViewSegments(tx, viewId, segments, watchTime, builtAt)
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	ok, err := closeView(tx, viewId, builtAt, nil)
+	if err != nil || !ok {
+		tx.Rollback()
+		return false, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return false, &InternalError{error: err}
+	}
+
+	return true, nil
+}
+
+// FailViewFinalization closes a view whose timeline can't be built with the
+// error it failed with, so that it doesn't hold up the views due after it.
+// Its watch time is unknown and left out of the averages.
+func FailViewFinalization(viewId string, finalizeErr error) (bool, error) {
+	tx, err := transaction()
+	if err != nil {
+		return false, &InternalError{error: err}
+	}
+
+	open, err := lockOpenView(tx, viewId)
+	if err != nil || !open {
+		tx.Rollback()
+		return false, err
+	}
+
+	ok, err := closeView(tx, viewId, time.Now(), truncate(finalizeErr.Error(), 255))
+	if err != nil || !ok {
+		tx.Rollback()
+		return false, err
+	}
+
+	_, err = tx.Exec("UPDATE video_view SET view_duration = -1 WHERE view_id = ?", viewId)
+	if err != nil {
+		tx.Rollback()
+		return false, &InternalError{error: err}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return false, &InternalError{error: err}
+	}
+
+	return true, nil
+}
+
+// closeView marks an open view finalized at the given time, it returns false
+// if the view was already finalized
+func closeView(tx *sql.Tx, viewId string, at time.Time, finalizeError interface{}) (bool, error) {
+	// views the player didn't end get the reason they are finalized for, an
+	// abandoned one ended at its last heartbeat
+	heartbeatBefore := time.Unix(at.Unix() - conf.ViewHeartbeatTimeout, 0)
+	expiredBefore := time.Unix(at.Unix() - conf.ViewExpireTime, 0)
+	res, err := tx.Exec("UPDATE video_view SET end_reason = IFNULL(end_reason, CASE WHEN last_heartbeat_at < ? THEN ? WHEN created_at < ? THEN ? ELSE ? END), ended_at = IFNULL(ended_at, IFNULL(last_heartbeat_at, ?)), finalized_at = ?, finalize_error = ? WHERE view_id = ? AND finalized_at IS NULL",
+		heartbeatBefore, ViewEndAbandoned, expiredBefore, ViewEndExpired, ViewEndEnded, at, at, finalizeError, viewId)
+	if err != nil {
+		return false, &InternalError{error: err}
+	}
+
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return false, &InternalError{error: err}
+	}
+
+	return ra > 0, nil
+}
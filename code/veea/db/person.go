@@ -0,0 +1,142 @@
+package db
+
+import (
+	"database/sql"
+
+	"github.com/gpahal/veea/conf"
+	"github.com/gpahal/veea/privacy"
+)
+
+// TrackFunc sets the person index of every stats row of a view time given the
+// last known stats row of every person seen earlier in the view and the next
+// unused person index
+type TrackFunc func(known []*ViewStats, viewStatsList []*ViewStats, nextIndex int)
+
+// insertTrackedViewStats locks the view of a view time so that concurrent
+// frames of one view never hand out the same new person index, then tracks
+// and inserts the stats rows with the demographics the privacy mode of the
+// video allows. Tracking still sees the exact values of the new faces.
+func insertTrackedViewStats(tx *sql.Tx, viewTimeId int64, viewStatsList []*ViewStats, track TrackFunc) error {
+	var viewId, videoId string
+
+	rows, err := tx.Query("SELECT V.view_id, V.video_id FROM video_view AS V, video_view_time AS T WHERE T.id = ? AND T.view_id = V.view_id FOR UPDATE", viewTimeId)
+	if err != nil {
+		return err
+	}
+	if rows.Next() {
+		err = rows.Scan(&viewId, &videoId)
+	}
+	rows.Close()
+	if err != nil {
+		return err
+	}
+
+	privacyMode := privacy.DefaultMode
+	rows, err = tx.Query("SELECT privacy_mode FROM video WHERE video_id = ?", videoId)
+	if err != nil {
+		return err
+	}
+	if rows.Next() {
+		err = rows.Scan(&privacyMode)
+	}
+	rows.Close()
+	if err != nil {
+		return err
+	}
+
+	known, nextIndex, err := knownPersons(tx, viewId, viewTimeId)
+	if err != nil {
+		return err
+	}
+
+	for _, viewStats := range viewStatsList {
+		viewStats.ViewTimeId = viewTimeId
+	}
+	if track != nil {
+		track(known, viewStatsList, nextIndex)
+	}
+
+	for _, viewStats := range viewStatsList {
+		_, err = tx.Exec(insertViewStatsQuery, viewStatsValues(viewStats, privacyMode)...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// knownPersons returns the latest stats row of every person seen in the last
+// conf.PersonTrackViewTimes view times of the view before the given one and
+// the next unused person index of the view
+func knownPersons(tx *sql.Tx, viewId string, viewTimeId int64) ([]*ViewStats, int, error) {
+	// rows of later view times reserve their indexes too, a reanalyzed frame
+	// never hands out an index used after it
+	var nextIndex int
+	err := tx.QueryRow("SELECT COALESCE(MAX(S.person_index) + 1, 0) FROM video_view_stats AS S, video_view_time AS T WHERE S.view_time_id = T.id AND T.view_id = ?", viewId).Scan(&nextIndex)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := tx.Query("SELECT id FROM video_view_time WHERE view_id = ? AND id < ? ORDER BY id DESC LIMIT ?", viewId, viewTimeId, conf.PersonTrackViewTimes)
+	if err != nil {
+		return nil, 0, err
+	}
+	var firstViewTimeId int64
+	for rows.Next() {
+		err = rows.Scan(&firstViewTimeId)
+		if err != nil {
+			rows.Close()
+			return nil, 0, err
+		}
+	}
+	rows.Close()
+
+	known := []*ViewStats{}
+	if firstViewTimeId == 0 {
+		return known, nextIndex, nil
+	}
+
+	rows, err = tx.Query("SELECT S.view_time_id, S.person_index, S.gender, S.age, S.head_x, S.head_y, S.head_z FROM video_view_stats AS S, video_view_time AS T WHERE S.view_time_id = T.id AND T.view_id = ? AND T.id >= ? AND T.id < ? ORDER BY S.view_time_id DESC", viewId, firstViewTimeId, viewTimeId)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	seen := make(map[int]bool)
+
+	for rows.Next() {
+		var viewStats ViewStats
+		var gender sql.NullFloat64
+		var age sql.NullInt64
+		err = rows.Scan(
+			&viewStats.ViewTimeId,
+			&viewStats.PersonIndex,
+			&gender,
+			&age,
+			&viewStats.HeadX,
+			&viewStats.HeadY,
+			&viewStats.HeadZ,
+		)
+
+		if err != nil {
+			return nil, 0, err
+		}
+
+		// demographics not stored because of the privacy mode are unknown
+		viewStats.Gender = gender.Float64
+		viewStats.Age = -1
+		if age.Valid {
+			viewStats.Age = int(age.Int64)
+		}
+
+		if seen[viewStats.PersonIndex] {
+			continue
+		}
+
+		seen[viewStats.PersonIndex] = true
+		known = append(known, &viewStats)
+	}
+
+	return known, nextIndex, nil
+}
@@ -0,0 +1,210 @@
+package db
+
+import (
+	"math"
+	"time"
+	"errors"
+	"database/sql"
+
+	"github.com/gpahal/veea/conf"
+)
+
+// reasons a sample is flagged as implausible, flagged samples are stored but
+// left out of the dashboard
+const (
+	ViewTimeFlagPastEnd = "past_end"
+	ViewTimeFlagBackwards = "backwards"
+	ViewTimeFlagTooFast = "too_fast"
+)
+
+// youtube player states
+const (
+	playerStateUnstarted = -1
+	playerStateEnded = 0
+	playerStatePlaying = 1
+	playerStatePaused = 2
+	playerStateBuffering = 3
+	playerStateCued = 5
+)
+
+// validateViewTime rejects samples that can never be valid
+func validateViewTime(viewTime *ViewTime) error {
+	if math.IsNaN(viewTime.Time) || math.IsInf(viewTime.Time, 0) || viewTime.Time < 0 {
+		return errors.New("Time must be a non negative number")
+	}
+
+	switch viewTime.State {
+	case playerStateUnstarted, playerStateEnded, playerStatePlaying, playerStatePaused, playerStateBuffering, playerStateCued:
+		return nil
+	default:
+		return errors.New("State is not a valid player state")
+	}
+}
+
+// validateViewTimeImage rejects samples without an image for videos that
+// require the camera, the player only sends them if the camera is optional
+func validateViewTimeImage(video *Video, viewTime *ViewTime) error {
+	if viewTime.Status == ViewTimeStatusNoImage && !video.CameraOptional {
+		return errors.New("Video requires a camera image with every frame")
+	}
+
+	return nil
+}
+
+// plausibilitySample is a sample a new one is compared with. Age is the number
+// of seconds since it was received, ClientTime is 0 for players that don't
+// send it.
+type plausibilitySample struct {
+	Time       float64
+	State      int
+	ClientTime int64
+	Age        float64
+	CreatedAt  time.Time
+}
+
+// flagViewTime returns the reason a sample is implausible given the video's
+// duration and the accepted samples captured right before and after it, or an
+// empty string. Frames sent again after a reconnect arrive after later ones,
+// so the neighbours are found by sequence number and the time between them is
+// taken from the client's capture times. A jump in either direction is fine
+// if the player reported a seek in between.
+func flagViewTime(video *Video, viewTime *ViewTime) (string, error) {
+	if video.Duration > 0 && viewTime.Time > video.Duration + conf.PlausibilityTolerance {
+		return ViewTimeFlagPastEnd, nil
+	}
+
+	current := &plausibilitySample{Time: viewTime.Time, State: viewTime.State, ClientTime: viewTime.ClientTime, CreatedAt: time.Now()}
+
+	var prev, next *plausibilitySample
+	var err error
+	if viewTime.Seq > 0 {
+		prev, err = neighbourSample("view_id = ? AND seq < ? AND flag IS NULL ORDER BY seq DESC", viewTime.ViewId, viewTime.Seq)
+		if err != nil {
+			return "", err
+		}
+		next, err = neighbourSample("view_id = ? AND seq > ? AND flag IS NULL ORDER BY seq", viewTime.ViewId, viewTime.Seq)
+		if err != nil {
+			return "", err
+		}
+	} else {
+		// players without sequence numbers send their frames in order
+		prev, err = neighbourSample("view_id = ? AND flag IS NULL ORDER BY id DESC", viewTime.ViewId)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if prev != nil {
+		flag, err := jumpFlag(viewTime.ViewId, prev, current)
+		if err != nil || flag != "" {
+			return flag, err
+		}
+	}
+	if next != nil {
+		return jumpFlag(viewTime.ViewId, current, next)
+	}
+
+	return "", nil
+}
+
+func neighbourSample(where string, args ...interface{}) (*plausibilitySample, error) {
+	rows, err := query("SELECT time, state, COALESCE(client_time, 0), TIMESTAMPDIFF(SECOND, created_at, CURRENT_TIMESTAMP), created_at FROM video_view_time WHERE " + where + " LIMIT 1", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, nil
+	}
+
+	var sample plausibilitySample
+	err = rows.Scan(&sample.Time, &sample.State, &sample.ClientTime, &sample.Age, &sample.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &sample, nil
+}
+
+// jumpFlag returns the reason the move of the player from the earlier to the
+// later sample is implausible, or an empty string
+func jumpFlag(viewId string, earlier *plausibilitySample, later *plausibilitySample) (string, error) {
+	var seeked bool
+	var err error
+	if earlier.ClientTime > 0 && later.ClientTime > 0 {
+		seeked, err = exists("SELECT 1 FROM video_view_event WHERE view_id = ? AND type = ? AND client_time BETWEEN ? AND ? LIMIT 1", viewId, ViewEventSeek, earlier.ClientTime, later.ClientTime)
+	} else {
+		seeked, err = exists("SELECT 1 FROM video_view_event WHERE view_id = ? AND type = ? AND created_at >= ? LIMIT 1", viewId, ViewEventSeek, seeksReceivedSince(earlier, later))
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return implausibleJump(earlier, later, elapsedBetween(earlier, later), seeked), nil
+}
+
+// seeksReceivedSince returns the time from which a seek received may have
+// happened between two samples without client times. The later sample is
+// received first if the earlier one was sent again after a reconnect, a seek
+// between them then arrived at most a seek window before it.
+func seeksReceivedSince(earlier *plausibilitySample, later *plausibilitySample) time.Time {
+	if later.CreatedAt.Before(earlier.CreatedAt) {
+		return later.CreatedAt.Add(-time.Duration(conf.PlausibilitySeekWindow) * time.Second)
+	}
+
+	return earlier.CreatedAt
+}
+
+// elapsedBetween returns the seconds between the capture of two samples, by
+// their client times if both have one and by the times they were received
+// otherwise
+func elapsedBetween(earlier *plausibilitySample, later *plausibilitySample) float64 {
+	if earlier.ClientTime > 0 && later.ClientTime > 0 {
+		return math.Max(float64(later.ClientTime - earlier.ClientTime) / 1000, 0)
+	}
+
+	// created_at has a precision of one second
+	return math.Abs(earlier.Age - later.Age) + 1
+}
+
+// implausibleJump returns the reason the player can't have moved from the
+// earlier to the later sample in elapsed seconds without a seek, or an empty
+// string
+func implausibleJump(earlier *plausibilitySample, later *plausibilitySample, elapsed float64, seeked bool) string {
+	if seeked {
+		return ""
+	}
+
+	delta := later.Time - earlier.Time
+
+	if delta > elapsed * conf.PlausibilityMaxRate + conf.PlausibilityTolerance {
+		return ViewTimeFlagTooFast
+	}
+
+	// an ended video is started again from the beginning
+	if delta < -conf.PlausibilityTolerance && earlier.State != playerStateEnded {
+		return ViewTimeFlagBackwards
+	}
+
+	return ""
+}
+
+func exists(q string, args ...interface{}) (bool, error) {
+	rows, err := query(q, args...)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	return rows.Next(), rows.Err()
+}
+
+// unflagSeekedViewTimes clears the jump flags of the samples of a view that a
+// seek arriving after them explains, their seek events are uploaded less
+// often than frames
+func unflagSeekedViewTimes(tx *sql.Tx, viewId string, seekClientTime int64) error {
+	_, err := tx.Exec("UPDATE video_view_time SET flag = NULL WHERE view_id = ? AND flag IN (?, ?) AND client_time BETWEEN ? AND ?",
+		viewId, ViewTimeFlagTooFast, ViewTimeFlagBackwards, seekClientTime, seekClientTime + conf.PlausibilitySeekWindow * 1000)
+	return err
+}
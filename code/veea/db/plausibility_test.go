@@ -0,0 +1,151 @@
+package db
+
+import (
+	"time"
+	"testing"
+
+	"github.com/gpahal/veea/conf"
+)
+
+func TestFlagViewTimePastEnd(t *testing.T) {
+	video := &Video{Duration: 100}
+
+	// a sample past the end is flagged before any earlier sample is read
+	flag, err := flagViewTime(video, &ViewTime{ViewId: "view", Time: 100 + conf.PlausibilityTolerance + 1, State: playerStatePlaying})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if flag != ViewTimeFlagPastEnd {
+		t.Errorf("flag = %q, want %q", flag, ViewTimeFlagPastEnd)
+	}
+}
+
+func TestValidateViewTime(t *testing.T) {
+	tests := []struct {
+		name  string
+		time  float64
+		state int
+		valid bool
+	}{
+		{"playing", 12.5, playerStatePlaying, true},
+		{"cued at start", 0, playerStateCued, true},
+		{"negative time", -1, playerStatePlaying, false},
+		{"unknown state", 10, 4, false},
+	}
+
+	for _, test := range tests {
+		err := validateViewTime(&ViewTime{Time: test.time, State: test.state})
+		if (err == nil) != test.valid {
+			t.Errorf("%s: error = %v, want valid %v", test.name, err, test.valid)
+		}
+	}
+}
+
+func TestValidateViewTimeImage(t *testing.T) {
+	tests := []struct {
+		name           string
+		cameraOptional bool
+		status         int
+		valid          bool
+	}{
+		{"image with camera required", false, ViewTimeStatusQueued, true},
+		{"no image with camera required", false, ViewTimeStatusNoImage, false},
+		{"no image with camera optional", true, ViewTimeStatusNoImage, true},
+	}
+
+	for _, test := range tests {
+		err := validateViewTimeImage(&Video{CameraOptional: test.cameraOptional}, &ViewTime{Status: test.status})
+		if (err == nil) != test.valid {
+			t.Errorf("%s: error = %v, want valid %v", test.name, err, test.valid)
+		}
+	}
+}
+
+func TestElapsedBetween(t *testing.T) {
+	tests := []struct {
+		name    string
+		earlier *plausibilitySample
+		later   *plausibilitySample
+		elapsed float64
+	}{
+		{"client times", &plausibilitySample{ClientTime: 10000, Age: 1}, &plausibilitySample{ClientTime: 13000, Age: 60}, 3},
+		{"client clock going back", &plausibilitySample{ClientTime: 13000}, &plausibilitySample{ClientTime: 10000}, 0},
+		{"receive times", &plausibilitySample{Age: 6}, &plausibilitySample{Age: 0}, 7},
+		{"one client time missing", &plausibilitySample{ClientTime: 10000, Age: 3}, &plausibilitySample{Age: 0}, 4},
+	}
+
+	for _, test := range tests {
+		elapsed := elapsedBetween(test.earlier, test.later)
+		if elapsed != test.elapsed {
+			t.Errorf("%s: elapsed = %v, want %v", test.name, elapsed, test.elapsed)
+		}
+	}
+}
+
+func TestSeeksReceivedSince(t *testing.T) {
+	now := time.Now()
+	window := time.Duration(conf.PlausibilitySeekWindow) * time.Second
+
+	tests := []struct {
+		name    string
+		earlier *plausibilitySample
+		later   *plausibilitySample
+		since   time.Time
+	}{
+		{"in order", &plausibilitySample{CreatedAt: now.Add(-3 * time.Second)}, &plausibilitySample{CreatedAt: now}, now.Add(-3 * time.Second)},
+		{"received at once", &plausibilitySample{CreatedAt: now}, &plausibilitySample{CreatedAt: now}, now},
+		{"earlier sent again", &plausibilitySample{CreatedAt: now}, &plausibilitySample{CreatedAt: now.Add(-20 * time.Second)}, now.Add(-20 * time.Second - window)},
+	}
+
+	for _, test := range tests {
+		since := seeksReceivedSince(test.earlier, test.later)
+		if !since.Equal(test.since) {
+			t.Errorf("%s: since = %v, want %v", test.name, since, test.since)
+		}
+	}
+}
+
+func TestImplausibleJump(t *testing.T) {
+	tests := []struct {
+		name    string
+		earlier *plausibilitySample
+		later   *plausibilitySample
+		elapsed float64
+		seeked  bool
+		flag    string
+	}{
+		{"normal playback", &plausibilitySample{Time: 10, State: playerStatePlaying}, &plausibilitySample{Time: 13}, 3, false, ""},
+		{"double speed", &plausibilitySample{Time: 10, State: playerStatePlaying}, &plausibilitySample{Time: 16}, 3, false, ""},
+		{"too fast", &plausibilitySample{Time: 10, State: playerStatePlaying}, &plausibilitySample{Time: 40}, 3, false, ViewTimeFlagTooFast},
+		{"forward seek", &plausibilitySample{Time: 10, State: playerStatePlaying}, &plausibilitySample{Time: 40}, 3, true, ""},
+		{"jitter backwards", &plausibilitySample{Time: 10, State: playerStatePaused}, &plausibilitySample{Time: 8}, 3, false, ""},
+		{"backwards", &plausibilitySample{Time: 60, State: playerStatePlaying}, &plausibilitySample{Time: 10}, 3, false, ViewTimeFlagBackwards},
+		{"backward seek", &plausibilitySample{Time: 60, State: playerStatePlaying}, &plausibilitySample{Time: 10}, 3, true, ""},
+		{"replay after end", &plausibilitySample{Time: 60, State: playerStateEnded}, &plausibilitySample{Time: 1}, 3, false, ""},
+	}
+
+	for _, test := range tests {
+		flag := implausibleJump(test.earlier, test.later, test.elapsed, test.seeked)
+		if flag != test.flag {
+			t.Errorf("%s: flag = %q, want %q", test.name, flag, test.flag)
+		}
+	}
+}
+
+func TestJumpSentAgainWithoutClientTimes(t *testing.T) {
+	// a sample sent again after a reconnect is compared with the next one by
+	// sequence, which was received 3 seconds before it
+	now := time.Now()
+	current := &plausibilitySample{Time: 10, State: playerStatePlaying, CreatedAt: now}
+	next := &plausibilitySample{Time: 100, State: playerStatePlaying, Age: 3, CreatedAt: now.Add(-3 * time.Second)}
+
+	since := seeksReceivedSince(current, next)
+	if since.IsZero() || !since.Before(next.CreatedAt) {
+		t.Errorf("seeks received since %v, want a window before %v", since, next.CreatedAt)
+	}
+
+	flag := implausibleJump(current, next, elapsedBetween(current, next), false)
+	if flag != ViewTimeFlagTooFast {
+		t.Errorf("flag = %q, want %q", flag, ViewTimeFlagTooFast)
+	}
+}
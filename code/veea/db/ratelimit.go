@@ -0,0 +1,65 @@
+package db
+
+import (
+	"time"
+)
+
+// TakeRateLimitTokens locks the token bucket of key, creating it full with
+// burst tokens, and stores the number of tokens update returns for the
+// tokens it held and the seconds since it was last updated. Times are taken
+// from the database so that the clocks of the instances don't matter.
+func TakeRateLimitTokens(key string, burst float64, update func(tokens float64, elapsed float64) float64) error {
+	tx, err := transaction()
+	if err != nil {
+		return &InternalError{error: err}
+	}
+
+	_, err = tx.Exec("INSERT IGNORE INTO rate_limit_bucket (bucket_key, tokens, updated_at) VALUES (?, ?, UNIX_TIMESTAMP(NOW(6)))", key, burst)
+	if err != nil {
+		tx.Rollback()
+		return &InternalError{error: err}
+	}
+
+	rows, err := tx.Query("SELECT tokens, UNIX_TIMESTAMP(NOW(6)) - updated_at FROM rate_limit_bucket WHERE bucket_key = ? FOR UPDATE", key)
+	if err != nil {
+		tx.Rollback()
+		return &InternalError{error: err}
+	}
+
+	var tokens, elapsed float64
+	if rows.Next() {
+		err = rows.Scan(&tokens, &elapsed)
+	}
+	rows.Close()
+	if err != nil {
+		tx.Rollback()
+		return &InternalError{error: err}
+	}
+
+	_, err = tx.Exec("UPDATE rate_limit_bucket SET tokens = ?, updated_at = UNIX_TIMESTAMP(NOW(6)) WHERE bucket_key = ?", update(tokens, elapsed), key)
+	if err != nil {
+		tx.Rollback()
+		return &InternalError{error: err}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return &InternalError{error: err}
+	}
+
+	return nil
+}
+
+func DeleteIdleRateLimitBuckets(idle time.Duration) (int64, error) {
+	res, err := exec("DELETE FROM rate_limit_bucket WHERE updated_at < UNIX_TIMESTAMP(NOW(6)) - ?", idle.Seconds())
+	if err != nil {
+		return 0, &InternalError{error: err}
+	}
+
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return 0, &InternalError{error: err}
+	}
+
+	return ra, nil
+}
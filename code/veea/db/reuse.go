@@ -0,0 +1,127 @@
+package db
+
+import (
+	"errors"
+	"database/sql"
+)
+
+// FrameHash is the hash of the image of a view time, DHash is only valid if
+// Perceptual is set. Reuses is the number of view times that reuse its
+// analysis, it is only read.
+type FrameHash struct {
+	ViewTimeId int64
+	Status     int
+	Hash       string
+	DHash      uint64
+	Perceptual bool
+	Reuses     int
+}
+
+func SetViewTimeFrameHash(frameHash *FrameHash) error {
+	var dHash interface{}
+	if frameHash.Perceptual {
+		// stored as a signed BIGINT, the driver refuses uint64 values with the
+		// high bit set
+		dHash = int64(frameHash.DHash)
+	}
+
+	_, err := exec("UPDATE video_view_time SET frame_hash = ?, frame_dhash = ? WHERE id = ?", frameHash.Hash, dHash, frameHash.ViewTimeId)
+	if err != nil {
+		return &InternalError{error: err}
+	}
+
+	return nil
+}
+
+// GetPreviousSourceFrameHash returns the hash of the frame that was analyzed
+// for the latest frame of the view of a view time submitted before it (that
+// frame itself unless it reused an analysis), found is false if there is none.
+// Frames are compared with the analyzed one so that a slow drift through
+// frames that each look like the one before isn't reused forever.
+func GetPreviousSourceFrameHash(viewTimeId int64) (*FrameHash, bool, error) {
+	rows, err := query("SELECT S.id, S.status, S.frame_hash, S.frame_dhash, (SELECT COUNT(*) FROM video_view_time AS R WHERE R.reused_from = S.id) FROM video_view_time AS T, video_view_time AS P, video_view_time AS S WHERE T.id = ? AND P.view_id = T.view_id AND P.id < T.id AND P.frame_hash IS NOT NULL AND S.id = COALESCE(P.reused_from, P.id) AND S.frame_hash IS NOT NULL ORDER BY P.id DESC LIMIT 1", viewTimeId)
+	if err != nil {
+		return nil, false, &InternalError{error: err}
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		var frameHash FrameHash
+		var dHash sql.NullInt64
+		err = rows.Scan(&frameHash.ViewTimeId, &frameHash.Status, &frameHash.Hash, &dHash, &frameHash.Reuses)
+		if err != nil {
+			return nil, false, &InternalError{error: err}
+		}
+
+		frameHash.DHash = uint64(dHash.Int64)
+		frameHash.Perceptual = dHash.Valid
+
+		return &frameHash, true, nil
+	}
+
+	return nil, false, nil
+}
+
+// ReuseViewStats gives a view time a copy of the stats rows and the status of
+// an earlier view time of the same view whose frame was the same, instead of
+// analyzing its frame again
+func ReuseViewStats(viewTimeId int64, sourceViewTimeId int64) (*ViewTimeStatus, error) {
+	tx, err := transaction()
+	if err != nil {
+		return nil, &InternalError{error: err}
+	}
+
+	rows, err := tx.Query("SELECT status, people_count, people_success_count, failures FROM video_view_time WHERE id = ? AND status = ?", sourceViewTimeId, ViewTimeStatusAnalyzed)
+	if err != nil {
+		tx.Rollback()
+		return nil, &InternalError{error: err}
+	}
+
+	viewTimeStatus := &ViewTimeStatus{ViewTimeId: viewTimeId}
+	found := rows.Next()
+	if found {
+		var failures sql.NullString
+		err = rows.Scan(&viewTimeStatus.Status, &viewTimeStatus.PeopleCount, &viewTimeStatus.PeopleSuccessCount, &failures)
+		viewTimeStatus.Failures = failures.String
+	}
+	rows.Close()
+	if err != nil {
+		tx.Rollback()
+		return nil, &InternalError{error: err}
+	}
+	if !found {
+		tx.Rollback()
+		return nil, &UserError{error: errors.New("View time to reuse is not analyzed")}
+	}
+
+	_, err = tx.Exec("INSERT INTO video_view_stats (view_time_id, person_index, gender, age, age_bucket, mood, head_yaw, head_pitch, head_roll, head_x, head_y, head_z, head_gaze_x, head_gaze_y, happy, surprised, angry, disgusted, afraid, sad, engagement, engagement_model, analyzer_version) SELECT ?, person_index, gender, age, age_bucket, mood, head_yaw, head_pitch, head_roll, head_x, head_y, head_z, head_gaze_x, head_gaze_y, happy, surprised, angry, disgusted, afraid, sad, engagement, engagement_model, analyzer_version FROM video_view_stats WHERE view_time_id = ? ORDER BY id", viewTimeId, sourceViewTimeId)
+	if err != nil {
+		tx.Rollback()
+		return nil, &InternalError{error: err}
+	}
+
+	var failures interface{}
+	if viewTimeStatus.Failures != "" {
+		failures = viewTimeStatus.Failures
+	}
+
+	_, err = tx.Exec("UPDATE video_view_time SET status = ?, people_count = ?, people_success_count = ?, failures = ?, reused_from = ? WHERE id = ?",
+		viewTimeStatus.Status,
+		viewTimeStatus.PeopleCount,
+		viewTimeStatus.PeopleSuccessCount,
+		failures,
+		sourceViewTimeId,
+		viewTimeId,
+	)
+	if err != nil {
+		tx.Rollback()
+		return nil, &InternalError{error: err}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, &InternalError{error: err}
+	}
+
+	return viewTimeStatus, nil
+}
@@ -0,0 +1,177 @@
+package db
+
+import (
+	"time"
+	"database/sql"
+)
+
+// kind of a segment of the playback timeline of a view
+const (
+	ViewSegmentWatched = "watched"
+	ViewSegmentRewatched = "rewatched"
+	ViewSegmentSkipped = "skipped"
+	ViewSegmentPause = "pause"
+)
+
+// ViewSegment is a range of the video in a view's playback timeline. Pauses
+// have the same start and end time and a duration in wall clock seconds.
+type ViewSegment struct {
+	Kind     string
+	Start    float64
+	End      float64
+	Duration float64
+}
+
+// ViewSample is an accepted sample of a view, ClientTime is 0 for players
+// that don't send it
+type ViewSample struct {
+	Time       float64
+	State      int
+	ClientTime int64
+	CreatedAt  time.Time
+}
+
+// GetStaleTimelineViewIds returns the open views that got samples or events
+// since their timeline was last built
+func GetStaleTimelineViewIds() ([]string, error) {
+	rows, err := query("SELECT V.view_id FROM video_view AS V WHERE V.finalized_at IS NULL AND (EXISTS (SELECT 1 FROM video_view_time AS T WHERE T.view_id = V.view_id AND (V.timeline_updated_at IS NULL OR T.created_at >= V.timeline_updated_at)) OR EXISTS (SELECT 1 FROM video_view_event AS E WHERE E.view_id = V.view_id AND (V.timeline_updated_at IS NULL OR E.created_at >= V.timeline_updated_at)))")
+	if err != nil {
+		return nil, &InternalError{error: err}
+	}
+	defer rows.Close()
+
+	viewIds := []string{}
+
+	for rows.Next() {
+		var viewId string
+		err = rows.Scan(&viewId)
+
+		if err != nil {
+			return nil, &InternalError{error: err}
+		}
+
+		viewIds = append(viewIds, viewId)
+	}
+
+	return viewIds, nil
+}
+
+func GetViewSamples(viewId string) ([]*ViewSample, error) {
+	// frames sent again after a reconnect are stored after later ones, samples
+	// are ordered by capture (views without sequence numbers by id)
+	rows, err := query("SELECT time, state, COALESCE(client_time, 0), created_at FROM video_view_time WHERE view_id = ? AND flag IS NULL ORDER BY seq, id", viewId)
+	if err != nil {
+		return nil, &InternalError{error: err}
+	}
+	defer rows.Close()
+
+	samples := []*ViewSample{}
+
+	for rows.Next() {
+		var sample ViewSample
+		err = rows.Scan(&sample.Time, &sample.State, &sample.ClientTime, &sample.CreatedAt)
+
+		if err != nil {
+			return nil, &InternalError{error: err}
+		}
+
+		samples = append(samples, &sample)
+	}
+
+	return samples, nil
+}
+
+func GetViewEvents(viewId string) ([]*ViewEvent, error) {
+	rows, err := query("SELECT type, video_time, client_time, COALESCE(from_time, 0), COALESCE(to_time, 0), COALESCE(quality, ''), COALESCE(rate, 0), created_at FROM video_view_event WHERE view_id = ? ORDER BY client_time, id", viewId)
+	if err != nil {
+		return nil, &InternalError{error: err}
+	}
+	defer rows.Close()
+
+	viewEvents := []*ViewEvent{}
+
+	for rows.Next() {
+		var viewEvent ViewEvent
+		err = rows.Scan(
+			&viewEvent.Type,
+			&viewEvent.VideoTime,
+			&viewEvent.ClientTime,
+			&viewEvent.From,
+			&viewEvent.To,
+			&viewEvent.Quality,
+			&viewEvent.Rate,
+			&viewEvent.CreatedAt,
+		)
+
+		if err != nil {
+			return nil, &InternalError{error: err}
+		}
+
+		viewEvents = append(viewEvents, &viewEvent)
+	}
+
+	return viewEvents, nil
+}
+
+// ReplaceViewSegments swaps the timeline of a view and its watch time (in
+// seconds), builtAt is the time its samples and events were read at. It
+// returns false if the view was finalized in the meantime, its final timeline
+// is then kept.
+func ReplaceViewSegments(viewId string, segments []*ViewSegment, watchTime float64, builtAt time.Time) (bool, error) {
+	tx, err := transaction()
+	if err != nil {
+		return false, &InternalError{error: err}
+	}
+
+	open, err := lockOpenView(tx, viewId)
+	if err != nil || !open {
+		tx.Rollback()
+		return false, err
+	}
+
+	err = replaceViewSegments(tx, viewId, segments, watchTime, builtAt)
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return false, &InternalError{error: err}
+	}
+
+	return true, nil
+}
+
+// lockOpenView locks the row of a view until the transaction ends, it returns
+// false if the view is already finalized
+func lockOpenView(tx *sql.Tx, viewId string) (bool, error) {
+	rows, err := tx.Query("SELECT view_id FROM video_view WHERE view_id = ? AND finalized_at IS NULL FOR UPDATE", viewId)
+	if err != nil {
+		return false, &InternalError{error: err}
+	}
+	defer rows.Close()
+
+	return rows.Next(), rows.Err()
+}
+
+func replaceViewSegments(tx *sql.Tx, viewId string, segments []*ViewSegment, watchTime float64, builtAt time.Time) error {
+	_, err := tx.Exec("DELETE FROM video_view_segment WHERE view_id = ?", viewId)
+	if err != nil {
+		return &InternalError{error: err}
+	}
+
+	for _, segment := range segments {
+		_, err = tx.Exec("INSERT INTO video_view_segment (view_id, kind, start_time, end_time, duration) VALUES (?, ?, ?, ?, ?)", viewId, segment.Kind, segment.Start, segment.End, segment.Duration)
+		if err != nil {
+			return &InternalError{error: err}
+		}
+	}
+
+	_, err = tx.Exec("UPDATE video_view SET view_duration = ?, timeline_updated_at = ? WHERE view_id = ?", watchTime, builtAt, viewId)
+	if err != nil {
+		return &InternalError{error: err}
+	}
+
+	return nil
+}
@@ -91,7 +91,7 @@ func VideoIdExists(videoId string) error {
 }
 
 func ViewIdNotExpiredExists(videoId string, viewId string) error {
-	rows, err := query("SELECT * FROM video_view WHERE video_id = ? AND view_id = ? AND created_at >= ?", videoId, viewId, time.Unix(time.Now().Unix() - conf.ViewExpireTime, 0))
+	rows, err := query("SELECT * FROM video_view WHERE video_id = ? AND view_id = ? AND created_at >= ? AND finalized_at IS NULL", videoId, viewId, time.Unix(time.Now().Unix() - conf.ViewExpireTime, 0))
 	if err != nil {
 		return err
 	}
@@ -103,6 +103,37 @@ func ViewIdNotExpiredExists(videoId string, viewId string) error {
 	return errors.New("View id does not exist")
 }
 
+// ViewIdOfUser requires a view to belong to the user, a view id is only handed
+// to the user who watches it
+func ViewIdOfUser(viewId string, userId int64) error {
+	rows, err := query("SELECT * FROM video_view WHERE view_id = ? AND user_id = ?", viewId, userId)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		return nil
+	}
+	return errors.New("View id does not exist")
+}
+
+// ViewIdConsented requires a view to have been started with a consent of its
+// user. The consent version is checked when the view starts, a view started
+// under an earlier text keeps capturing after a new one is published.
+func ViewIdConsented(viewId string) error {
+	rows, err := query("SELECT * FROM video_view AS V, consent AS C WHERE V.view_id = ? AND V.consent_id = C.id AND C.user_id = V.user_id", viewId)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		return nil
+	}
+	return errors.New("View has no consent for webcam capture")
+}
+
 func ViewTimeIdExists(viewTimeId int64) error {
 	rows, err := query("SELECT * FROM video_view_time WHERE id = ?", viewTimeId)
 	if err != nil {
@@ -223,4 +254,12 @@ func GenerateViewId() (string, error) {
 	}
 
 	return "", errors.New("Unable to generate view id")
-}
\ No newline at end of file
+}
+
+func truncate(str string, length int) string {
+	if len(str) > length {
+		return str[:length]
+	}
+
+	return str
+}
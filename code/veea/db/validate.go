@@ -26,3 +26,11 @@ func validateUsername(username string) error {
 func validateFullname(fullName string) error {
 	return validateLength("Fullname", fullName, 80)
 }
+
+func validateConsentVersion(consentText *ConsentText, version int64) error {
+	if consentText.Version != version {
+		return errors.New("The consent text has changed, please read the new version")
+	}
+
+	return nil
+}
@@ -4,50 +4,95 @@ import (
 	"time"
 	"errors"
 	"sync"
-"github.com/gpahal/veea/conf"
+	"database/sql"
+	"github.com/go-sql-driver/mysql"
+	"github.com/gpahal/veea/privacy"
 )
 
 type Video struct {
-	VideoId   string
-	Name      string
-	CreatedAt time.Time
+	VideoId            string
+	Name               string
+	ArchiveFrames      bool
+	FrameRetentionDays int
+	EngagementModel    string
+	Duration           float64
+	PrivacyMode        string
+	// participants without a webcam can watch, only their playback is tracked
+	CameraOptional     bool
+	CreatedAt          time.Time
 }
 
+// ViewTime is the sample of a single frame. ClientTime is the wall clock time
+// the frame was captured at on the client in milliseconds since the epoch, 0
+// if the player didn't send it.
 type ViewTime struct {
-	ViewId  string
-	Time    float64
-	State   int
-	Quality string
+	ViewId     string
+	Seq        int64
+	ClientTime int64
+	Time       float64
+	State      int
+	Quality    string
+	Status     int
+	Flag       string
+}
+
+type ViewTimeStatus struct {
+	ViewTimeId         int64
+	Status             int
+	PeopleCount        int
+	PeopleSuccessCount int
+	Failures           string
+	// reason the frame was rejected before analysis, if it was
+	Rejected           string
 }
 
 type ViewStats struct {
-	ViewTimeId int64
-	Gender     float64
-	Age        int
-	Mood       float64
-	HeadYaw    float64
-	HeadPitch  float64
-	HeadRoll   float64
-	HeadX      float64
-	HeadY      float64
-	HeadZ      float64
-	HeadGazeX  float64
-	HeadGazeY  float64
-	Happy      float64
-	Surprised  float64
-	Angry      float64
-	Disgusted  float64
-	Afraid     float64
-	Sad        float64
-	Engagement float64
+	ViewTimeId      int64
+	PersonIndex     int
+	Gender          float64
+	Age             int
+	Mood            float64
+	HeadYaw         float64
+	HeadPitch       float64
+	HeadRoll        float64
+	HeadX           float64
+	HeadY           float64
+	HeadZ           float64
+	HeadGazeX       float64
+	HeadGazeY       float64
+	Happy           float64
+	Surprised       float64
+	Angry           float64
+	Disgusted       float64
+	Afraid          float64
+	Sad             float64
+	Engagement      float64
+	EngagementModel string
+	AnalyzerVersion string
 }
 
+// analysis status of a view time
+const (
+	ViewTimeStatusError = 0
+	ViewTimeStatusNoImage = 1
+	ViewTimeStatusQueued = 2
+	ViewTimeStatusAnalyzed = 3
+	ViewTimeStatusDropped = 4
+	// the analyzer was down, the frame was not analyzed
+	ViewTimeStatusUnavailable = 5
+	// the frame was not worth analyzing, the reason is in rejected
+	ViewTimeStatusRejected = 6
+)
+
 var (
 	viewIdLock sync.Mutex
 )
 
+// error number of mysql for a duplicate key
+const mysqlDuplicateEntry = 1062
+
 func GetVideo(videoId string) (*Video, error) {
-	rows, err := query("SELECT video_id, name, created_at FROM video WHERE video_id = ? LIMIT 1", videoId)
+	rows, err := query("SELECT video_id, name, archive_frames, frame_retention_days, engagement_model, duration, privacy_mode, camera_optional, created_at FROM video WHERE video_id = ? LIMIT 1", videoId)
 	if err != nil {
 		return nil, &InternalError{error: err}
 	}
@@ -55,9 +100,16 @@ func GetVideo(videoId string) (*Video, error) {
 
 	if rows.Next() {
 		var video Video
+		var archiveFrames, cameraOptional int
 		err = rows.Scan(
 			&video.VideoId,
 			&video.Name,
+			&archiveFrames,
+			&video.FrameRetentionDays,
+			&video.EngagementModel,
+			&video.Duration,
+			&video.PrivacyMode,
+			&cameraOptional,
 			&video.CreatedAt,
 		)
 
@@ -65,16 +117,22 @@ func GetVideo(videoId string) (*Video, error) {
 			return nil, &InternalError{error: err}
 		}
 
+		video.ArchiveFrames = archiveFrames > 0
+		video.CameraOptional = cameraOptional > 0
+
 		return &video, nil
 	}
 
 	return nil, &UserError{error: errors.New("Video does not exist")}
 }
 
-func AddVideoView(userId int64, videoId string) (string, error) {
+// AddVideoView creates a view of a video for a user who accepted a consent
+// text, consentId is the id of that acceptance
+func AddVideoView(userId int64, videoId string, consentId int64) (string, error) {
 	err := errorFold(
 		UserIdExists(userId),
 		VideoIdExists(videoId),
+		consentIdOfUser(userId, consentId),
 	)
 	if err != nil {
 		return "", &UserError{error: err}
@@ -88,7 +146,7 @@ func AddVideoView(userId int64, videoId string) (string, error) {
 		return "", &InternalError{error: err}
 	}
 
-	res, err := exec("INSERT INTO video_view (user_id, video_id, view_id) VALUES (?, ?, ?)", userId, videoId, viewId)
+	res, err := exec("INSERT INTO video_view (user_id, video_id, view_id, consent_id) VALUES (?, ?, ?, ?)", userId, videoId, viewId, consentId)
 	if err != nil {
 		return "", &InternalError{error: err}
 	}
@@ -104,139 +162,291 @@ func AddVideoView(userId int64, videoId string) (string, error) {
 	return viewId, nil
 }
 
-func AddViewTime(videoId string, viewTime *ViewTime) (int64, error) {
+// AddViewTime stores a sample of a view and returns its id. A sample with a
+// sequence number (Seq > 0) that was already stored for the view is not
+// stored again, the id of the original is returned with created set to false.
+// Implausible samples are stored with the reason in viewTime.Flag.
+func AddViewTime(video *Video, viewTime *ViewTime) (int64, bool, error) {
 	err := errorFold(
-		ViewIdNotExpiredExists(videoId, viewTime.ViewId),
+		ViewIdNotExpiredExists(video.VideoId, viewTime.ViewId),
+		ViewIdConsented(viewTime.ViewId),
+		validateViewTime(viewTime),
+		validateViewTimeImage(video, viewTime),
 	)
 	if err != nil {
-		return 0, &UserError{error: err}
+		return 0, false, &UserError{error: err}
 	}
 
-	res, err := exec("INSERT INTO video_view_time (view_id, time, state, quality) VALUES (?, ?, ?, ?)", viewTime.ViewId, viewTime.Time, viewTime.State, viewTime.Quality)
+	viewTime.Flag, err = flagViewTime(video, viewTime)
 	if err != nil {
-		return 0, &InternalError{error: err}
+		return 0, false, &InternalError{error: err}
+	}
+
+	var seq, clientTime, flag interface{}
+	if viewTime.Seq > 0 {
+		seq = viewTime.Seq
+	}
+	if viewTime.ClientTime > 0 {
+		clientTime = viewTime.ClientTime
+	}
+	if viewTime.Flag != "" {
+		flag = viewTime.Flag
+	}
+
+	res, err := exec("INSERT INTO video_view_time (view_id, seq, client_time, time, state, quality, status, flag) VALUES (?, ?, ?, ?, ?, ?, ?, ?)", viewTime.ViewId, seq, clientTime, viewTime.Time, viewTime.State, viewTime.Quality, viewTime.Status, flag)
+	if err != nil {
+		if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == mysqlDuplicateEntry && viewTime.Seq > 0 {
+			id, err := getViewTimeIdBySeq(viewTime.ViewId, viewTime.Seq)
+			if err != nil {
+				return 0, false, err
+			}
+			return id, false, nil
+		}
+		return 0, false, &InternalError{error: err}
 	}
 
 	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, false, &InternalError{error: err}
+	}
+
+	return id, true, nil
+}
+
+func getViewTimeIdBySeq(viewId string, seq int64) (int64, error) {
+	rows, err := query("SELECT id FROM video_view_time WHERE view_id = ? AND seq = ? LIMIT 1", viewId, seq)
 	if err != nil {
 		return 0, &InternalError{error: err}
 	}
+	defer rows.Close()
+
+	if rows.Next() {
+		var id int64
+		err = rows.Scan(&id)
+
+		if err != nil {
+			return 0, &InternalError{error: err}
+		}
+
+		return id, nil
+	}
 
-	return id, nil
+	return 0, &InternalError{error: errors.New("Duplicate view time does not exist")}
 }
 
-func AddViewStats(viewStats *ViewStats) (int64, error) {
-	err := errorFold(
-		ViewTimeIdExists(viewStats.ViewTimeId),
+func UpdateViewTimeStatus(viewTimeStatus *ViewTimeStatus) error {
+	var failures, rejected interface{}
+	if viewTimeStatus.Failures != "" {
+		failures = viewTimeStatus.Failures
+	}
+	if viewTimeStatus.Rejected != "" {
+		rejected = viewTimeStatus.Rejected
+	}
+
+	_, err := exec("UPDATE video_view_time SET status = ?, people_count = ?, people_success_count = ?, failures = ?, rejected = ? WHERE id = ?",
+		viewTimeStatus.Status,
+		viewTimeStatus.PeopleCount,
+		viewTimeStatus.PeopleSuccessCount,
+		failures,
+		rejected,
+		viewTimeStatus.ViewTimeId,
 	)
 	if err != nil {
-		return 0, &UserError{error: err}
+		return &InternalError{error: err}
 	}
 
-	columns := "view_time_id, gender, age, mood, head_yaw, head_pitch, head_roll, head_x, head_y, head_z, head_gaze_x, head_gaze_y, happy, surprised, angry, disgusted, afraid, sad, engagement"
+	return nil
+}
 
-	res, err := exec("INSERT INTO video_view_stats (" + columns + ") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
-		viewStats.ViewTimeId,
-		viewStats.Gender,
-		viewStats.Age,
-		viewStats.Mood,
-		viewStats.HeadYaw,
-		viewStats.HeadPitch,
-		viewStats.HeadRoll,
-		viewStats.HeadX,
-		viewStats.HeadY,
-		viewStats.HeadZ,
-		viewStats.HeadGazeX,
-		viewStats.HeadGazeY,
-		viewStats.Happy,
-		viewStats.Surprised,
-		viewStats.Angry,
-		viewStats.Disgusted,
-		viewStats.Afraid,
-		viewStats.Sad,
-		viewStats.Engagement,
-	)
+// RequeueViewTime marks a view time whose frame was never analyzed (it was
+// dropped or the analyzer was down) as queued again, it returns false if the
+// view time has another status, so a frame sent again concurrently is queued
+// only once
+func RequeueViewTime(viewTimeId int64) (bool, error) {
+	res, err := exec("UPDATE video_view_time SET status = ?, people_count = 0, people_success_count = 0, failures = NULL WHERE id = ? AND status IN (?, ?)",
+		ViewTimeStatusQueued, viewTimeId, ViewTimeStatusDropped, ViewTimeStatusUnavailable)
 	if err != nil {
-		return 0, &InternalError{error: err}
+		return false, &InternalError{error: err}
 	}
 
-	id, err := res.LastInsertId()
+	ra, err := res.RowsAffected()
 	if err != nil {
-		return 0, &InternalError{error: err}
+		return false, &InternalError{error: err}
 	}
 
-	return id, nil
+	return ra > 0, nil
 }
 
-func UpdateVideoDuration() error {
-	currentTime := time.Now().Unix()
-	maxExpireTime := time.Unix(currentTime - conf.ViewExpireTime, 0)
+func GetViewTimeStatus(userId int64, videoId string, viewTimeId int64) (*ViewTimeStatus, error) {
+	rows, err := query("SELECT B.id, B.status, B.people_count, B.people_success_count, B.failures FROM video_view AS A, video_view_time AS B WHERE A.user_id = ? AND A.video_id = ? AND A.view_id = B.view_id AND B.id = ? LIMIT 1", userId, videoId, viewTimeId)
+	if err != nil {
+		return nil, &InternalError{error: err}
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		return scanViewTimeStatus(rows)
+	}
+
+	return nil, &UserError{error: errors.New("View time does not exist")}
+}
 
-	rows, err := query("SELECT view_id FROM video_view WHERE view_duration >= 0 AND created_at < ?", maxExpireTime)
+func GetViewTimeStatusById(viewTimeId int64) (*ViewTimeStatus, error) {
+	rows, err := query("SELECT id, status, people_count, people_success_count, failures FROM video_view_time WHERE id = ? LIMIT 1", viewTimeId)
 	if err != nil {
-		return &InternalError{error: err}
+		return nil, &InternalError{error: err}
 	}
 	defer rows.Close()
 
-	for rows.Next() {
-		var videoId string
-		err = rows.Scan(&videoId)
+	if rows.Next() {
+		return scanViewTimeStatus(rows)
+	}
 
-		if err != nil {
-			return &InternalError{error: err}
-		}
+	return nil, &UserError{error: errors.New("View time does not exist")}
+}
 
-		err = UpdateVideoDurationSingle(videoId)
-		if err != nil {
-			return &InternalError{error: err}
-		}
+func scanViewTimeStatus(rows *sql.Rows) (*ViewTimeStatus, error) {
+	var viewTimeStatus ViewTimeStatus
+	var failures sql.NullString
+	err := rows.Scan(
+		&viewTimeStatus.ViewTimeId,
+		&viewTimeStatus.Status,
+		&viewTimeStatus.PeopleCount,
+		&viewTimeStatus.PeopleSuccessCount,
+		&failures,
+	)
+
+	if err != nil {
+		return nil, &InternalError{error: err}
 	}
 
-	return nil
+	if failures.Valid {
+		viewTimeStatus.Failures = failures.String
+	}
+
+	return &viewTimeStatus, nil
 }
 
-func UpdateVideoDurationSingle(viewId string) error {
-	rows, err := query("SELECT time FROM video_view_time WHERE view_id = ?", viewId)
+// AddViewStats stores the stats rows of all the faces of a view time, every
+// row gets the index of the person it belongs to from track
+func AddViewStats(viewTimeId int64, viewStatsList []*ViewStats, track TrackFunc) error {
+	err := errorFold(
+		ViewTimeIdExists(viewTimeId),
+	)
+	if err != nil {
+		return &UserError{error: err}
+	}
+
+	tx, err := transaction()
 	if err != nil {
 		return &InternalError{error: err}
 	}
-	defer rows.Close()
 
-	times := []int{}
+	err = insertTrackedViewStats(tx, viewTimeId, viewStatsList, track)
+	if err != nil {
+		tx.Rollback()
+		return &InternalError{error: err}
+	}
 
-	for rows.Next() {
-		var time float64
-		err = rows.Scan(&time)
+	err = tx.Commit()
+	if err != nil {
+		return &InternalError{error: err}
+	}
 
-		if err != nil {
-			return &InternalError{error: err}
-		}
+	return nil
+}
 
-		index := int(time / 5)
-		currentLength := len(times)
+// ReplaceViewStats atomically swaps all the stats rows of a view time with
+// the given ones and updates its status
+func ReplaceViewStats(viewTimeStatus *ViewTimeStatus, viewStatsList []*ViewStats, track TrackFunc) error {
+	err := errorFold(
+		ViewTimeIdExists(viewTimeStatus.ViewTimeId),
+	)
+	if err != nil {
+		return &UserError{error: err}
+	}
 
-		if index < currentLength {
-			times[index] += 1
-		} else {
-			incrementRequired := index - currentLength + 1
-			for i := 0; i < incrementRequired; i += 1 {
-				times = append(times, 0)
-			}
-			times[index] += 1
-		}
+	tx, err := transaction()
+	if err != nil {
+		return &InternalError{error: err}
 	}
 
-	count := 0
-	for _, timeSingle := range times {
-		if timeSingle > 0 {
-			count += 1
-		}
+	_, err = tx.Exec("DELETE FROM video_view_stats WHERE view_time_id = ?", viewTimeStatus.ViewTimeId)
+	if err != nil {
+		tx.Rollback()
+		return &InternalError{error: err}
 	}
 
-	_, err = exec("UPDATE video_view SET view_duration = ? WHERE view_id = ?", float64(count * 5), viewId)
+	err = insertTrackedViewStats(tx, viewTimeStatus.ViewTimeId, viewStatsList, track)
+	if err != nil {
+		tx.Rollback()
+		return &InternalError{error: err}
+	}
+
+	var failures interface{}
+	if viewTimeStatus.Failures != "" {
+		failures = viewTimeStatus.Failures
+	}
+
+	_, err = tx.Exec("UPDATE video_view_time SET status = ?, people_count = ?, people_success_count = ?, failures = ? WHERE id = ?",
+		viewTimeStatus.Status,
+		viewTimeStatus.PeopleCount,
+		viewTimeStatus.PeopleSuccessCount,
+		failures,
+		viewTimeStatus.ViewTimeId,
+	)
+	if err != nil {
+		tx.Rollback()
+		return &InternalError{error: err}
+	}
+
+	err = tx.Commit()
 	if err != nil {
 		return &InternalError{error: err}
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+const insertViewStatsQuery = "INSERT INTO video_view_stats (view_time_id, person_index, gender, age, age_bucket, mood, head_yaw, head_pitch, head_roll, head_x, head_y, head_z, head_gaze_x, head_gaze_y, happy, surprised, angry, disgusted, afraid, sad, engagement, engagement_model, analyzer_version) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+
+// viewStatsValues returns the values of insertViewStatsQuery, demographics
+// the privacy mode of the video doesn't allow are stored as NULL
+func viewStatsValues(viewStats *ViewStats, privacyMode string) []interface{} {
+	var gender, age, ageBucket interface{}
+	if privacy.KeepsGender(privacyMode) {
+		gender = viewStats.Gender
+	}
+	if privacy.KeepsAge(privacyMode) {
+		age = viewStats.Age
+	}
+	if bucket := privacy.AgeBucket(viewStats.Age); bucket >= 0 && privacy.KeepsAgeBucket(privacyMode) {
+		ageBucket = bucket
+	}
+
+	return []interface{}{
+		viewStats.ViewTimeId,
+		viewStats.PersonIndex,
+		gender,
+		age,
+		ageBucket,
+		viewStats.Mood,
+		viewStats.HeadYaw,
+		viewStats.HeadPitch,
+		viewStats.HeadRoll,
+		viewStats.HeadX,
+		viewStats.HeadY,
+		viewStats.HeadZ,
+		viewStats.HeadGazeX,
+		viewStats.HeadGazeY,
+		viewStats.Happy,
+		viewStats.Surprised,
+		viewStats.Angry,
+		viewStats.Disgusted,
+		viewStats.Afraid,
+		viewStats.Sad,
+		viewStats.Engagement,
+		viewStats.EngagementModel,
+		viewStats.AnalyzerVersion,
+	}
+}
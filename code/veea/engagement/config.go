@@ -0,0 +1,111 @@
+package engagement
+
+import (
+	"os"
+	"fmt"
+	"errors"
+	"io/ioutil"
+	"encoding/json"
+
+	"github.com/gpahal/veea/conf"
+)
+
+// kinds of models a models file can define
+const (
+	kindWeightedRms = "weighted-rms"
+	kindEmotionDamped = "emotion-damped"
+)
+
+// ModelConfig defines a model in a models file. Weighted rms models take
+// Weights, emotion damped models the id of an earlier or built in Base model
+// and EmotionWeight.
+type ModelConfig struct {
+	Id            string `json:"id"`
+	Kind          string `json:"kind"`
+	Weights       map[string]float64 `json:"weights"`
+	Base          string `json:"base"`
+	EmotionWeight float64 `json:"emotionWeight"`
+}
+
+type modelsFile struct {
+	Models []*ModelConfig `json:"models"`
+}
+
+// LoadModels registers the models of conf.EngagementModelsFile next to the
+// built in ones, a missing file defines none
+func LoadModels() error {
+	return LoadFile(conf.EngagementModelsFile)
+}
+
+func LoadFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var file modelsFile
+	err = json.Unmarshal(data, &file)
+	if err != nil {
+		return err
+	}
+
+	return RegisterConfigs(file.Models)
+}
+
+// RegisterConfigs builds and registers the models in order. A model id can't
+// be registered twice, the scores stored with an id must keep meaning the same
+// formula, so changed weights need a new id.
+func RegisterConfigs(configs []*ModelConfig) error {
+	for _, config := range configs {
+		scorer, err := config.build()
+		if err != nil {
+			return err
+		}
+
+		if _, err := Get(config.Id); err == nil {
+			return errors.New(fmt.Sprintf("Engagement model %s is already registered", config.Id))
+		}
+
+		Register(scorer)
+	}
+
+	return nil
+}
+
+func (config *ModelConfig) build() (Scorer, error) {
+	if config == nil || config.Id == "" {
+		return nil, errors.New("Engagement model must have an id")
+	}
+
+	switch config.Kind {
+	case kindWeightedRms:
+		if len(config.Weights) == 0 {
+			return nil, errors.New(fmt.Sprintf("Engagement model %s must have weights", config.Id))
+		}
+		for name := range config.Weights {
+			if !isMeasurement(name) {
+				return nil, errors.New(fmt.Sprintf("Engagement model %s weights unknown measurement %s", config.Id, name))
+			}
+		}
+
+		weights := make(map[string]float64, len(config.Weights))
+		for name, weight := range config.Weights {
+			weights[name] = weight
+		}
+		return NewWeightedRms(config.Id, weights), nil
+	case kindEmotionDamped:
+		base, err := Get(config.Base)
+		if err != nil {
+			return nil, err
+		}
+		if config.EmotionWeight < 0 || config.EmotionWeight > 1 {
+			return nil, errors.New(fmt.Sprintf("Engagement model %s must have an emotion weight between 0 and 1", config.Id))
+		}
+		return &EmotionDamped{ModelId: config.Id, Base: base, EmotionWeight: config.EmotionWeight}, nil
+	default:
+		return nil, errors.New(fmt.Sprintf("Engagement model %s has unknown kind %s", config.Id, config.Kind))
+	}
+}
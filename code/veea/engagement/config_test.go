@@ -0,0 +1,94 @@
+package engagement
+
+import (
+	"os"
+	"testing"
+	"io/ioutil"
+	"path/filepath"
+)
+
+func TestRegisterConfigs(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *ModelConfig
+		valid  bool
+	}{
+		{"weighted rms", &ModelConfig{Id: "test-rms", Kind: kindWeightedRms, Weights: map[string]float64{"headYaw": 2, "headGazeX": 0.01}}, true},
+		{"emotion damped over a loaded model", &ModelConfig{Id: "test-emotion", Kind: kindEmotionDamped, Base: "test-rms", EmotionWeight: 0.4}, true},
+		{"emotion damped over a built in model", &ModelConfig{Id: "test-emotion-builtin", Kind: kindEmotionDamped, Base: DefaultModelId, EmotionWeight: 0.4}, true},
+		{"no id", &ModelConfig{Kind: kindWeightedRms, Weights: map[string]float64{"headYaw": 1}}, false},
+		{"registered id", &ModelConfig{Id: DefaultModelId, Kind: kindWeightedRms, Weights: map[string]float64{"headYaw": 1}}, false},
+		{"no weights", &ModelConfig{Id: "test-empty", Kind: kindWeightedRms}, false},
+		{"unknown measurement", &ModelConfig{Id: "test-unknown", Kind: kindWeightedRms, Weights: map[string]float64{"blink": 1}}, false},
+		{"unknown base", &ModelConfig{Id: "test-no-base", Kind: kindEmotionDamped, Base: "missing", EmotionWeight: 0.4}, false},
+		{"emotion weight above 1", &ModelConfig{Id: "test-heavy", Kind: kindEmotionDamped, Base: DefaultModelId, EmotionWeight: 2}, false},
+		{"unknown kind", &ModelConfig{Id: "test-kind", Kind: "linear"}, false},
+	}
+
+	for _, test := range tests {
+		err := RegisterConfigs([]*ModelConfig{test.config})
+		if (err == nil) != test.valid {
+			t.Errorf("%s: error = %v, want valid %v", test.name, err, test.valid)
+			continue
+		}
+
+		if test.config.Id == "" {
+			continue
+		}
+		_, getErr := Get(test.config.Id)
+		registered := getErr == nil
+		if test.valid && !registered {
+			t.Errorf("%s: model was not registered", test.name)
+		}
+		if !test.valid && registered && test.config.Id != DefaultModelId {
+			t.Errorf("%s: invalid model was registered", test.name)
+		}
+	}
+
+	scorer, err := Get("test-rms")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	score := scorer.Score(&Input{HeadYaw: 0.5, HeadGazeX: 100})
+	if score != Rms(1, 1) {
+		t.Errorf("score = %v, want %v", score, Rms(1, 1))
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "engagement")
+	if err != nil {
+		t.Fatalf("unable to create a directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name  string
+		body  string
+		valid bool
+	}{
+		{"missing file", "", true},
+		{"models", `{"models": [{"id": "test-file-rms", "kind": "weighted-rms", "weights": {"headPitch": 5}}]}`, true},
+		{"malformed", `{"models": [`, false},
+	}
+
+	for idx, test := range tests {
+		path := filepath.Join(dir, "missing.json")
+		if test.body != "" {
+			path = filepath.Join(dir, string(rune('a' + idx)) + ".json")
+			err = ioutil.WriteFile(path, []byte(test.body), 0600)
+			if err != nil {
+				t.Fatalf("unable to write %s: %v", path, err)
+			}
+		}
+
+		err = LoadFile(path)
+		if (err == nil) != test.valid {
+			t.Errorf("%s: error = %v, want valid %v", test.name, err, test.valid)
+		}
+	}
+
+	if _, err := Get("test-file-rms"); err != nil {
+		t.Errorf("model of the file was not registered: %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package engagement
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"errors"
+)
+
+// id of the model used for videos that do not choose one, it is the formula
+// every row was scored with before models were introduced
+const DefaultModelId = "rms-v1"
+
+// the measurements of a single face a model can score
+type Input struct {
+	HeadYaw   float64
+	HeadPitch float64
+	HeadRoll  float64
+	HeadGazeX float64
+	HeadGazeY float64
+	Mood      float64
+	Happy     float64
+	Surprised float64
+	Angry     float64
+	Disgusted float64
+	Afraid    float64
+	Sad       float64
+}
+
+// a versioned engagement formula, lower scores mean a more engaged viewer.
+// Changing the formula of a registered model requires a new id.
+type Scorer interface {
+	Id() string
+	Score(input *Input) float64
+}
+
+var (
+	registry     = map[string]Scorer{}
+	registryLock sync.RWMutex
+)
+
+func Register(scorer Scorer) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	registry[scorer.Id()] = scorer
+}
+
+func Get(id string) (Scorer, error) {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+
+	scorer, exists := registry[id]
+	if !exists {
+		return nil, errors.New(fmt.Sprintf("Engagement model %s does not exist", id))
+	}
+
+	return scorer, nil
+}
+
+// GetOrDefault returns the model with the given id or the default model if
+// there is no such model
+func GetOrDefault(id string) Scorer {
+	scorer, err := Get(id)
+	if err != nil {
+		scorer, _ = Get(DefaultModelId)
+	}
+
+	return scorer
+}
+
+func Ids() []string {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+
+	ids := make([]string, 0, len(registry))
+	for id := range registry {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	return ids
+}
@@ -0,0 +1,140 @@
+package engagement
+
+import (
+	"math"
+)
+
+// root mean square of the weighted measurements, measurements without a
+// weight are left out
+type WeightedRms struct {
+	ModelId string
+	Weights map[string]float64
+}
+
+func NewWeightedRms(id string, weights map[string]float64) *WeightedRms {
+	return &WeightedRms{ModelId: id, Weights: weights}
+}
+
+func (wr *WeightedRms) Id() string {
+	return wr.ModelId
+}
+
+func (wr *WeightedRms) Score(input *Input) float64 {
+	values := []float64{}
+	for _, name := range measurementNames {
+		weight, exists := wr.Weights[name]
+		if !exists {
+			continue
+		}
+		values = append(values, measurement(input, name) * weight)
+	}
+
+	return Rms(values...)
+}
+
+// scales a base model down by the strongest emotion of the face, on the
+// assumption that a viewer reacting to the video is paying attention
+type EmotionDamped struct {
+	ModelId       string
+	Base          Scorer
+	EmotionWeight float64
+}
+
+func (ed *EmotionDamped) Id() string {
+	return ed.ModelId
+}
+
+func (ed *EmotionDamped) Score(input *Input) float64 {
+	strongest := math.Max(input.Happy, math.Max(input.Surprised, math.Max(input.Angry,
+		math.Max(input.Disgusted, math.Max(input.Afraid, input.Sad)))))
+	strongest = math.Min(math.Max(strongest, 0), 1)
+
+	return ed.Base.Score(input) * (1 - ed.EmotionWeight * strongest)
+}
+
+func Rms(values ...float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	var result float64 = 0
+
+	for _, value := range values {
+		result += value * value
+	}
+
+	result = result / float64(len(values))
+
+	return math.Sqrt(result)
+}
+
+var measurementNames = []string{
+	"headYaw", "headPitch", "headRoll", "headGazeX", "headGazeY",
+	"mood", "happy", "surprised", "angry", "disgusted", "afraid", "sad",
+}
+
+func isMeasurement(name string) bool {
+	for _, measurementName := range measurementNames {
+		if measurementName == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func measurement(input *Input, name string) float64 {
+	switch name {
+	case "headYaw":
+		return input.HeadYaw
+	case "headPitch":
+		return input.HeadPitch
+	case "headRoll":
+		return input.HeadRoll
+	case "headGazeX":
+		return input.HeadGazeX
+	case "headGazeY":
+		return input.HeadGazeY
+	case "mood":
+		return input.Mood
+	case "happy":
+		return input.Happy
+	case "surprised":
+		return input.Surprised
+	case "angry":
+		return input.Angry
+	case "disgusted":
+		return input.Disgusted
+	case "afraid":
+		return input.Afraid
+	case "sad":
+		return input.Sad
+	default:
+		return 0
+	}
+}
+
+func init() {
+	// head pose angles are in radians and gaze offsets in pixels, the weights
+	// bring both to a comparable scale
+	headPose := NewWeightedRms("rms-v1", map[string]float64{
+		"headYaw": 1 / 0.2,
+		"headPitch": 1 / 0.2,
+		"headGazeX": 1.0 / 300,
+		"headGazeY": 1.0 / 300,
+	})
+
+	Register(headPose)
+	Register(NewWeightedRms("rms-roll-v1", map[string]float64{
+		"headYaw": 1 / 0.2,
+		"headPitch": 1 / 0.2,
+		"headRoll": 1 / 0.3,
+		"headGazeX": 1.0 / 300,
+		"headGazeY": 1.0 / 300,
+	}))
+	Register(&EmotionDamped{
+		ModelId: "emotion-v1",
+		Base: headPose,
+		EmotionWeight: 0.5,
+	})
+}
@@ -0,0 +1,222 @@
+package framestore
+
+import (
+	"os"
+	"time"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/gpahal/veea/conf"
+)
+
+var ErrDisabled = errors.New("Frame store is disabled")
+
+// content addressed store of raw frames on the local disk, a frame is saved
+// under the hex encoded sha256 hash of its bytes
+type Store struct {
+	Dir string
+}
+
+func New(dir string) *Store {
+	return &Store{Dir: dir}
+}
+
+func Hash(image []byte) string {
+	sum := sha256.Sum256(image)
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *Store) Path(hash string) string {
+	return filepath.Join(s.Dir, hash[0:2], hash[2:4], hash + ".jpg")
+}
+
+// Put saves a frame and returns its hash, saving a frame that is already
+// present only refreshes its modification time so it isn't removed while its
+// new row is inserted
+func (s *Store) Put(image []byte) (string, error) {
+	hash := Hash(image)
+	path := s.Path(hash)
+
+	if _, err := os.Stat(path); err == nil {
+		now := time.Now()
+		err = os.Chtimes(path, now, now)
+		if err != nil {
+			return "", err
+		}
+		return hash, nil
+	}
+
+	err := os.MkdirAll(filepath.Dir(path), 0750)
+	if err != nil {
+		return "", err
+	}
+
+	tmpFile, err := ioutil.TempFile(filepath.Dir(path), hash + ".tmp")
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tmpFile.Write(image)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpFile.Name())
+		return "", err
+	}
+
+	err = os.Rename(tmpFile.Name(), path)
+	if err != nil {
+		os.Remove(tmpFile.Name())
+		return "", err
+	}
+
+	return hash, nil
+}
+
+func (s *Store) Get(hash string) ([]byte, error) {
+	if !validHash(hash) {
+		return nil, errors.New("Invalid frame hash")
+	}
+
+	return ioutil.ReadFile(s.Path(hash))
+}
+
+func (s *Store) Remove(hash string) error {
+	if !validHash(hash) {
+		return errors.New("Invalid frame hash")
+	}
+
+	err := os.Remove(s.Path(hash))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// RemoveIfOlder removes a frame unless it was saved less than minAge ago, and
+// reports if it was removed
+func (s *Store) RemoveIfOlder(hash string, minAge time.Duration) (bool, error) {
+	if !validHash(hash) {
+		return false, errors.New("Invalid frame hash")
+	}
+
+	path := s.Path(hash)
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	if info.ModTime().After(time.Now().Add(-minAge)) {
+		return false, nil
+	}
+
+	err = os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// number of frames whose references are checked at once by Sweep
+const sweepBatchSize = 500
+
+// Sweep removes every frame older than minAge that referenced leaves out of
+// the hashes it returns and returns the number of removed frames. referenced
+// is called with up to sweepBatchSize hashes at a time.
+func (s *Store) Sweep(minAge time.Duration, referenced func(hashes []string) (map[string]bool, error)) (int, error) {
+	removed := 0
+	cutoff := time.Now().Add(-minAge)
+	batch := []string{}
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		isReferenced, err := referenced(batch)
+		if err != nil {
+			return err
+		}
+
+		for _, hash := range batch {
+			if isReferenced[hash] {
+				continue
+			}
+
+			ok, err := s.RemoveIfOlder(hash, minAge)
+			if err != nil {
+				return err
+			}
+			if ok {
+				removed += 1
+			}
+		}
+
+		batch = batch[:0]
+		return nil
+	}
+
+	err := filepath.Walk(s.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || filepath.Ext(path) != ".jpg" || info.ModTime().After(cutoff) {
+			return nil
+		}
+
+		hash := filepath.Base(path)
+		hash = hash[:len(hash) - len(".jpg")]
+		if !validHash(hash) {
+			return nil
+		}
+
+		batch = append(batch, hash)
+		if len(batch) >= sweepBatchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return removed, err
+	}
+
+	err = flush()
+	return removed, err
+}
+
+func validHash(hash string) bool {
+	if len(hash) != sha256.Size * 2 {
+		return false
+	}
+
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
+
+var defaultStore *Store
+
+func init() {
+	if conf.FrameStoreDir != "" {
+		defaultStore = New(conf.FrameStoreDir)
+	}
+}
+
+// Default returns the configured store or ErrDisabled if archiving is turned off
+func Default() (*Store, error) {
+	if defaultStore == nil {
+		return nil, ErrDisabled
+	}
+
+	return defaultStore, nil
+}
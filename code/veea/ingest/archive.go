@@ -0,0 +1,110 @@
+package ingest
+
+import (
+	"time"
+
+	"github.com/gpahal/veea/db"
+	"github.com/gpahal/veea/conf"
+	"github.com/gpahal/veea/framestore"
+	log "github.com/Sirupsen/logrus"
+)
+
+// frames younger than this are never swept, so that a frame written just
+// before its row is inserted is not removed
+const sweepMinAge = 10 * time.Minute
+
+// Archive keeps the raw frame of a view time if the video has archiving
+// turned on
+func Archive(video *db.Video, viewTimeId int64, image []byte) {
+	if !video.ArchiveFrames {
+		return
+	}
+
+	store, err := framestore.Default()
+	if err != nil {
+		return
+	}
+
+	hash, err := store.Put(image)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"viewTimeId": viewTimeId,
+			"error": err.Error(),
+		}).Error("Error archiving frame")
+		return
+	}
+
+	err = db.AddViewFrame(viewTimeId, hash)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"viewTimeId": viewTimeId,
+			"error": err.Error(),
+		}).Error("Error adding view frame")
+	}
+}
+
+// time of the last walk of the frame store
+var lastSweep time.Time
+
+// PurgeFrames applies the retention policy of every video and removes the
+// frames that are not referenced anymore. Expired frames are found through
+// their rows, the store is only walked every conf.FrameSweepInterval for the
+// frames of deleted views, whose rows are gone with them.
+func PurgeFrames() error {
+	store, err := framestore.Default()
+	if err != nil {
+		return nil
+	}
+
+	expired, removed := 0, 0
+	for {
+		hashes, err := db.DeleteExpiredViewFrames()
+		if err != nil {
+			return err
+		}
+		if len(hashes) == 0 {
+			break
+		}
+		expired += len(hashes)
+
+		referenced, err := db.FrameHashesReferenced(hashes)
+		if err != nil {
+			return err
+		}
+
+		for _, hash := range hashes {
+			if referenced[hash] {
+				continue
+			}
+
+			// the same frame may appear in several of the rows
+			referenced[hash] = true
+			ok, err := store.RemoveIfOlder(hash, sweepMinAge)
+			if err != nil {
+				return err
+			}
+			if ok {
+				removed += 1
+			}
+		}
+	}
+
+	swept := 0
+	if time.Since(lastSweep) >= time.Duration(conf.FrameSweepInterval) * time.Second {
+		swept, err = store.Sweep(sweepMinAge, db.FrameHashesReferenced)
+		if err != nil {
+			return err
+		}
+		lastSweep = time.Now()
+	}
+
+	if expired > 0 || removed > 0 || swept > 0 {
+		log.WithFields(log.Fields{
+			"expired": expired,
+			"removed": removed,
+			"swept": swept,
+		}).Info("Purged archived frames")
+	}
+
+	return nil
+}
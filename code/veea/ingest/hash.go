@@ -0,0 +1,81 @@
+package ingest
+
+import (
+	"image"
+
+	"github.com/gpahal/veea/framestore"
+)
+
+// frameHash identifies the image of a frame exactly (Hash) and by how it
+// looks (DHash, only set if Perceptual is)
+type frameHash struct {
+	Hash       string
+	DHash      uint64
+	Perceptual bool
+}
+
+// hashFrame hashes the bytes of a frame and, if perceptual is set and the
+// frame could be decoded (img is not nil), its image
+func hashFrame(data []byte, img image.Image, perceptual bool) *frameHash {
+	fh := &frameHash{Hash: framestore.Hash(data)}
+	if !perceptual || img == nil {
+		return fh
+	}
+
+	fh.DHash = dHash(img)
+	fh.Perceptual = true
+	return fh
+}
+
+// dHash is the difference hash of an image: the image is shrunk to 9x8 gray
+// cells and every bit tells if a cell is brighter than its right neighbour.
+// Frames that look alike differ in few bits.
+func dHash(img image.Image) uint64 {
+	const width, height = 9, 8
+
+	bounds := img.Bounds()
+	var cells [height][width]float64
+
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y * bounds.Dy() / height
+		y1 := bounds.Min.Y + (y + 1) * bounds.Dy() / height
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x * bounds.Dx() / width
+			x1 := bounds.Min.X + (x + 1) * bounds.Dx() / width
+
+			var sum float64
+			var count int
+			for py := y0; py < y1; py++ {
+				for px := x0; px < x1; px++ {
+					r, g, b, _ := img.At(px, py).RGBA()
+					sum += 0.299 * float64(r) + 0.587 * float64(g) + 0.114 * float64(b)
+					count += 1
+				}
+			}
+			if count > 0 {
+				cells[y][x] = sum / float64(count)
+			}
+		}
+	}
+
+	var hash uint64
+	for y := 0; y < height; y++ {
+		for x := 0; x < width - 1; x++ {
+			hash <<= 1
+			if cells[y][x] > cells[y][x + 1] {
+				hash |= 1
+			}
+		}
+	}
+
+	return hash
+}
+
+func hammingDistance(a uint64, b uint64) int {
+	distance := 0
+	for diff := a ^ b; diff != 0; diff &= diff - 1 {
+		distance += 1
+	}
+
+	return distance
+}
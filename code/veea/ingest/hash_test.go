@@ -0,0 +1,140 @@
+package ingest
+
+import (
+	"image"
+	"testing"
+	"image/color"
+)
+
+func flat(width int, height int, gray uint8) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = gray
+	}
+
+	return img
+}
+
+// gradient runs from one gray level on the left to another on the right, it
+// has contrast but no detail
+func gradient(width int, height int, from uint8, to uint8) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetGray(x, y, color.Gray{Y: uint8(int(from) + (int(to) - int(from)) * x / (width - 1))})
+		}
+	}
+
+	return img
+}
+
+// brighten adds delta to every pixel of a gray image
+func brighten(img *image.Gray, delta int) *image.Gray {
+	brightened := image.NewGray(img.Bounds())
+	for i, p := range img.Pix {
+		brightened.Pix[i] = uint8(int(p) + delta)
+	}
+
+	return brightened
+}
+
+// mirror flips a gray image left to right
+func mirror(img *image.Gray) *image.Gray {
+	bounds := img.Bounds()
+	mirrored := image.NewGray(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			mirrored.SetGray(bounds.Max.X - 1 - (x - bounds.Min.X), y, img.GrayAt(x, y))
+		}
+	}
+
+	return mirrored
+}
+
+func TestDHash(t *testing.T) {
+	frame := textured(320, 240, 1)
+
+	tests := []struct {
+		name        string
+		a           image.Image
+		b           image.Image
+		minDistance int
+		maxDistance int
+	}{
+		{"same frame", frame, textured(320, 240, 1), 0, 0},
+		{"brighter frame", frame, brighten(frame, 10), 0, 0},
+		{"mirrored frame", frame, mirror(frame), 10, 64},
+		{"other frame", frame, textured(320, 240, 2), 10, 64},
+		{"opposite gradients", gradient(320, 240, 0, 255), gradient(320, 240, 255, 0), 64, 64},
+	}
+
+	for _, test := range tests {
+		distance := hammingDistance(dHash(test.a), dHash(test.b))
+		if distance < test.minDistance || distance > test.maxDistance {
+			t.Errorf("%s: distance = %d, want %d to %d", test.name, distance, test.minDistance, test.maxDistance)
+		}
+	}
+}
+
+func TestDHashGradient(t *testing.T) {
+	tests := []struct {
+		name string
+		img  image.Image
+		hash uint64
+	}{
+		{"brightening to the right", gradient(90, 80, 0, 255), 0},
+		{"darkening to the right", gradient(90, 80, 255, 0), ^uint64(0)},
+		{"flat", flat(90, 80, 128), 0},
+	}
+
+	for _, test := range tests {
+		if hash := dHash(test.img); hash != test.hash {
+			t.Errorf("%s: hash = %x, want %x", test.name, hash, test.hash)
+		}
+	}
+}
+
+func TestHammingDistance(t *testing.T) {
+	tests := []struct {
+		a        uint64
+		b        uint64
+		distance int
+	}{
+		{0, 0, 0},
+		{0, 1, 1},
+		{0xff, 0x0f, 4},
+		{0, ^uint64(0), 64},
+	}
+
+	for _, test := range tests {
+		if distance := hammingDistance(test.a, test.b); distance != test.distance {
+			t.Errorf("hammingDistance(%x, %x) = %d, want %d", test.a, test.b, distance, test.distance)
+		}
+	}
+}
+
+func TestHashFrame(t *testing.T) {
+	data := []byte("frame")
+	img := textured(64, 48, 1)
+
+	tests := []struct {
+		name       string
+		img        image.Image
+		perceptual bool
+		hashed     bool
+	}{
+		{"perceptual", img, true, true},
+		{"exact only", img, false, false},
+		{"undecodable", nil, true, false},
+	}
+
+	for _, test := range tests {
+		fh := hashFrame(data, test.img, test.perceptual)
+		if len(fh.Hash) != 64 {
+			t.Errorf("%s: hash %q is not a sha256", test.name, fh.Hash)
+		}
+		if fh.Perceptual != test.hashed {
+			t.Errorf("%s: perceptual = %v, want %v", test.name, fh.Perceptual, test.hashed)
+		}
+	}
+}
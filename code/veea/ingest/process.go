@@ -0,0 +1,292 @@
+package ingest
+
+import (
+	"bytes"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"encoding/json"
+
+	"github.com/gpahal/veea/db"
+	"github.com/gpahal/veea/conf"
+	"github.com/gpahal/veea/analyzer"
+	"github.com/gpahal/veea/engagement"
+	log "github.com/Sirupsen/logrus"
+)
+
+// Process analyzes the frame of a job, or reuses the analysis of the previous
+// frame of the view if it is the same, and stores the stats and the final
+// status of its view time
+func Process(job *Job) {
+	img, reason := decodeFrame(job.Image)
+
+	viewTimeStatus := gate(job, img, reason)
+	if viewTimeStatus == nil {
+		viewTimeStatus = reuse(job, img)
+	}
+	if viewTimeStatus == nil {
+		viewTimeStatus = Analyze(job.Video, job.ViewTimeId, job.Image)
+	}
+
+	err := db.UpdateViewTimeStatus(viewTimeStatus)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"viewTimeId": job.ViewTimeId,
+			"error": err.Error(),
+		}).Error("Error updating view time status")
+	}
+
+	if job.Done != nil {
+		job.Done(viewTimeStatus)
+	}
+}
+
+// decodeFrame decodes the image of a frame if the quality gate or the
+// perceptual hash need it. The size is read from the header first, a frame
+// larger than FrameMaxPixels is never decoded and is returned with its reject
+// reason, as is one that can't be decoded.
+func decodeFrame(data []byte) (image.Image, string) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, RejectUndecodable
+	}
+	if config.Width * config.Height > conf.FrameMaxPixels {
+		return nil, RejectTooLarge
+	}
+
+	if !conf.QualityGating && !conf.FramePerceptualHash {
+		return nil, ""
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, RejectUndecodable
+	}
+
+	return img, ""
+}
+
+// gate rejects the frame of a job if it is not worth analyzing (it can't be
+// decoded or is too small, dark, bright, flat or blurry), the returned status
+// carries the reason and is stored by Process. Frames that are too large are
+// always rejected. It returns nil if the frame has to be analyzed.
+func gate(job *Job, img image.Image, reason string) *db.ViewTimeStatus {
+	if reason != RejectTooLarge {
+		if !conf.QualityGating {
+			return nil
+		}
+		if reason == "" {
+			reason = measureQuality(img).Reject()
+		}
+	}
+	if reason == "" {
+		return nil
+	}
+
+	return &db.ViewTimeStatus{ViewTimeId: job.ViewTimeId, Status: db.ViewTimeStatusRejected, Rejected: reason}
+}
+
+// reuse copies the analysis of the previous frame of the view to the frame
+// of a job if the frame analyzed for it and the job's frame are identical, or
+// look alike within FrameReuseMaxDistance, and the analysis was reused less
+// than FrameReuseMaxCount times. It returns nil if the frame has to be
+// analyzed.
+func reuse(job *Job, img image.Image) *db.ViewTimeStatus {
+	if !conf.FrameReuse {
+		return nil
+	}
+
+	fh := hashFrame(job.Image, img, conf.FramePerceptualHash)
+
+	previous, found, err := db.GetPreviousSourceFrameHash(job.ViewTimeId)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"viewTimeId": job.ViewTimeId,
+			"error": err.Error(),
+		}).Error("Error getting previous frame hash")
+	}
+
+	err = db.SetViewTimeFrameHash(&db.FrameHash{ViewTimeId: job.ViewTimeId, Hash: fh.Hash, DHash: fh.DHash, Perceptual: fh.Perceptual})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"viewTimeId": job.ViewTimeId,
+			"error": err.Error(),
+		}).Error("Error storing frame hash")
+	}
+
+	if !found || previous.Status != db.ViewTimeStatusAnalyzed || previous.Reuses >= conf.FrameReuseMaxCount {
+		return nil
+	}
+
+	same := fh.Hash == previous.Hash
+	if !same && fh.Perceptual && previous.Perceptual {
+		same = hammingDistance(fh.DHash, previous.DHash) <= conf.FrameReuseMaxDistance
+	}
+	if !same {
+		return nil
+	}
+
+	viewTimeStatus, err := db.ReuseViewStats(job.ViewTimeId, previous.ViewTimeId)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"viewTimeId": job.ViewTimeId,
+			"reusedFrom": previous.ViewTimeId,
+			"error": err.Error(),
+		}).Warn("Error reusing analysis of previous frame")
+		return nil
+	}
+
+	return viewTimeStatus
+}
+
+// Analyze runs a frame through the analyzer and stores a stats row for every
+// valid face. Faces that are invalid or could not be stored are recorded as
+// failures in the returned status.
+func Analyze(video *db.Video, viewTimeId int64, image []byte) *db.ViewTimeStatus {
+	a, err := analyze(video, viewTimeId, image)
+	if err == analyzer.ErrUnavailable {
+		return &db.ViewTimeStatus{ViewTimeId: viewTimeId, Status: db.ViewTimeStatusUnavailable}
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"viewTimeId": viewTimeId,
+			"error": err.Error(),
+		}).Error("Error analyzing frame")
+		return &db.ViewTimeStatus{ViewTimeId: viewTimeId, Status: db.ViewTimeStatusError}
+	}
+
+	count := len(a.viewStatsList)
+	err = db.AddViewStats(viewTimeId, a.viewStatsList, TrackPersons)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"viewTimeId": viewTimeId,
+			"error": err.Error(),
+		}).Error("Error storing view stats")
+
+		for idx := range a.viewStatsList {
+			a.failures = append(a.failures, &analyzer.FaceFailure{Index: idx, Reason: "unable to store face"})
+		}
+		count = 0
+	}
+
+	a.viewTimeStatus.PeopleSuccessCount = count
+	a.viewTimeStatus.Failures = EncodeFailures(a.failures)
+
+	return a.viewTimeStatus
+}
+
+type analysis struct {
+	viewTimeStatus *db.ViewTimeStatus
+	viewStatsList  []*db.ViewStats
+	failures       []*analyzer.FaceFailure
+}
+
+// analyze runs a frame through the analyzer without storing anything, an
+// error is only returned if the analyzer could not be used at all
+func analyze(video *db.Video, viewTimeId int64, image []byte) (*analysis, error) {
+	fa := analyzer.Get()
+	scorer := engagement.GetOrDefault(video.EngagementModel)
+	a := &analysis{
+		viewTimeStatus: &db.ViewTimeStatus{ViewTimeId: viewTimeId, Status: db.ViewTimeStatusAnalyzed},
+	}
+
+	result, err := fa.Analyze(image)
+	if err != nil {
+		switch err.(type) {
+		case *analyzer.ReplyError:
+			return a, nil
+		default:
+			return nil, err
+		}
+	}
+
+	for _, face := range result.Faces {
+		viewStats := ViewStatsFromFace(face, scorer)
+		viewStats.ViewTimeId = viewTimeId
+		viewStats.AnalyzerVersion = fa.Version()
+
+		a.viewStatsList = append(a.viewStatsList, viewStats)
+	}
+
+	a.failures = result.Failures
+	a.viewTimeStatus.PeopleCount = len(result.Faces) + len(result.Failures)
+
+	return a, nil
+}
+
+func EncodeFailures(failures []*analyzer.FaceFailure) string {
+	if len(failures) == 0 {
+		return ""
+	}
+
+	encoded, err := json.Marshal(failures)
+	if err != nil {
+		return ""
+	}
+
+	return string(encoded)
+}
+
+func DecodeFailures(encoded string) []*analyzer.FaceFailure {
+	var failures []*analyzer.FaceFailure
+	if encoded == "" {
+		return failures
+	}
+
+	json.Unmarshal([]byte(encoded), &failures)
+	return failures
+}
+
+func ViewStatsFromFace(face *analyzer.Face, scorer engagement.Scorer) *db.ViewStats {
+	viewStats := &db.ViewStats{}
+
+	if face.Gender == "male" {
+		viewStats.Gender = -1
+	} else if face.Gender == "female" {
+		viewStats.Gender = 1
+	} else {
+		viewStats.Gender = 0
+	}
+
+	viewStats.Age = face.Age
+	viewStats.Mood = face.Mood
+
+	viewStats.HeadX = face.HeadPose.X
+	viewStats.HeadY = face.HeadPose.Y
+	viewStats.HeadZ = face.HeadPose.Z
+	viewStats.HeadYaw = face.HeadPose.Yaw
+	viewStats.HeadPitch = face.HeadPose.Pitch
+	viewStats.HeadRoll = face.HeadPose.Roll
+
+	viewStats.HeadGazeX = face.HeadGaze.X
+	viewStats.HeadGazeY = face.HeadGaze.Y
+
+	viewStats.Happy = face.Emotions.Happy
+	viewStats.Surprised = face.Emotions.Surprised
+	viewStats.Angry = face.Emotions.Angry
+	viewStats.Disgusted = face.Emotions.Disgusted
+	viewStats.Afraid = face.Emotions.Afraid
+	viewStats.Sad = face.Emotions.Sad
+
+	viewStats.Engagement = scorer.Score(EngagementInput(viewStats))
+	viewStats.EngagementModel = scorer.Id()
+
+	return viewStats
+}
+
+func EngagementInput(viewStats *db.ViewStats) *engagement.Input {
+	return &engagement.Input{
+		HeadYaw: viewStats.HeadYaw,
+		HeadPitch: viewStats.HeadPitch,
+		HeadRoll: viewStats.HeadRoll,
+		HeadGazeX: viewStats.HeadGazeX,
+		HeadGazeY: viewStats.HeadGazeY,
+		Mood: viewStats.Mood,
+		Happy: viewStats.Happy,
+		Surprised: viewStats.Surprised,
+		Angry: viewStats.Angry,
+		Disgusted: viewStats.Disgusted,
+		Afraid: viewStats.Afraid,
+		Sad: viewStats.Sad,
+	}
+}
@@ -0,0 +1,164 @@
+package ingest
+
+import (
+	"bytes"
+	"image"
+	"testing"
+	"math/rand"
+	"hash/crc32"
+	"image/png"
+	"image/jpeg"
+	"image/color"
+	"encoding/binary"
+
+	"github.com/gpahal/veea/db"
+	"github.com/gpahal/veea/analyzer"
+	"github.com/gpahal/veea/engagement"
+)
+
+func encodeJpeg(t *testing.T, img image.Image) []byte {
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90})
+	if err != nil {
+		t.Fatalf("unable to encode frame: %v", err)
+	}
+
+	return buf.Bytes()
+}
+
+// textured is a frame with enough brightness, contrast and detail to be
+// analyzed, the same for the same seed
+func textured(width int, height int, seed int64) *image.Gray {
+	r := rand.New(rand.NewSource(seed))
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetGray(x, y, color.Gray{Y: uint8(20 + r.Intn(211))})
+		}
+	}
+
+	return img
+}
+
+// hugePng is a png whose header claims width x height pixels, only the header
+// is valid
+func hugePng(t *testing.T, width uint32, height uint32) []byte {
+	var buf bytes.Buffer
+	err := png.Encode(&buf, flat(1, 1, 128))
+	if err != nil {
+		t.Fatalf("unable to encode frame: %v", err)
+	}
+
+	// the IHDR chunk follows the 8 byte signature: length, type, 13 bytes of
+	// data starting with the width and height, crc of type and data
+	data := buf.Bytes()
+	binary.BigEndian.PutUint32(data[16:20], width)
+	binary.BigEndian.PutUint32(data[20:24], height)
+	binary.BigEndian.PutUint32(data[29:33], crc32.ChecksumIEEE(data[12:29]))
+
+	return data
+}
+
+func TestProcess(t *testing.T) {
+	previous := analyzer.Get()
+	analyzer.Set(analyzer.NewStubAnalyzer())
+	defer analyzer.Set(previous)
+
+	video := &db.Video{VideoId: "video", EngagementModel: engagement.DefaultModelId}
+
+	// the view times don't exist, storing their results fails and is only
+	// logged, the status the job ends with is still reported
+	tests := []struct {
+		name        string
+		image       []byte
+		status      int
+		peopleCount int
+	}{
+		{"analyzed", encodeJpeg(t, textured(320, 240, 1)), db.ViewTimeStatusAnalyzed, 1},
+		{"undecodable", []byte("not an image"), db.ViewTimeStatusRejected, 0},
+		{"too dark", encodeJpeg(t, flat(320, 240, 5)), db.ViewTimeStatusRejected, 0},
+		{"too small", encodeJpeg(t, textured(32, 24, 1)), db.ViewTimeStatusRejected, 0},
+		{"too large", hugePng(t, 20000, 20000), db.ViewTimeStatusRejected, 0},
+	}
+
+	for idx, test := range tests {
+		var done *db.ViewTimeStatus
+		job := &Job{
+			Video: video,
+			ViewTimeId: int64(-1 - idx),
+			Image: test.image,
+			Done: func(viewTimeStatus *db.ViewTimeStatus) {
+				done = viewTimeStatus
+			},
+		}
+
+		Process(job)
+
+		if done == nil {
+			t.Errorf("%s: done was not called", test.name)
+			continue
+		}
+		if done.ViewTimeId != job.ViewTimeId {
+			t.Errorf("%s: view time id = %d, want %d", test.name, done.ViewTimeId, job.ViewTimeId)
+		}
+		if done.Status != test.status {
+			t.Errorf("%s: status = %d, want %d", test.name, done.Status, test.status)
+		}
+		if (done.Rejected != "") != (test.status == db.ViewTimeStatusRejected) {
+			t.Errorf("%s: rejected = %q with status %d", test.name, done.Rejected, done.Status)
+		}
+		if done.PeopleCount != test.peopleCount {
+			t.Errorf("%s: people count = %d, want %d", test.name, done.PeopleCount, test.peopleCount)
+		}
+	}
+}
+
+func TestDecodeFrame(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		decoded bool
+		reason  string
+	}{
+		{"jpeg", encodeJpeg(t, textured(64, 48, 1)), true, ""},
+		{"undecodable", []byte("not an image"), false, RejectUndecodable},
+		{"too large", hugePng(t, 20000, 20000), false, RejectTooLarge},
+	}
+
+	for _, test := range tests {
+		img, reason := decodeFrame(test.data)
+		if (img != nil) != test.decoded || reason != test.reason {
+			t.Errorf("%s: decoded = %v, reason = %q, want %v, %q", test.name, img != nil, reason, test.decoded, test.reason)
+		}
+	}
+}
+
+func TestViewStatsFromFace(t *testing.T) {
+	scorer := engagement.GetOrDefault("")
+	faces := analyzer.NewStubAnalyzer().Faces
+
+	tests := []struct {
+		gender string
+		value  float64
+	}{
+		{"male", -1},
+		{"female", 1},
+		{"", 0},
+	}
+
+	for _, test := range tests {
+		face := *faces[0]
+		face.Gender = test.gender
+
+		viewStats := ViewStatsFromFace(&face, scorer)
+		if viewStats.Gender != test.value {
+			t.Errorf("gender %q: stored as %v, want %v", test.gender, viewStats.Gender, test.value)
+		}
+		if viewStats.EngagementModel != scorer.Id() {
+			t.Errorf("gender %q: engagement model = %q, want %q", test.gender, viewStats.EngagementModel, scorer.Id())
+		}
+		if viewStats.Age != face.Age || viewStats.HeadYaw != face.HeadPose.Yaw || viewStats.Happy != face.Emotions.Happy {
+			t.Errorf("gender %q: face not copied: %+v", test.gender, viewStats)
+		}
+	}
+}
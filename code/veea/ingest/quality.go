@@ -0,0 +1,103 @@
+package ingest
+
+import (
+	"math"
+	"image"
+
+	"github.com/gpahal/veea/conf"
+)
+
+// reasons a frame is rejected before analysis, stored on its view time
+const (
+	RejectUndecodable = "undecodable"
+	RejectTooLarge = "too_large"
+	RejectTooSmall = "too_small"
+	RejectTooDark = "too_dark"
+	RejectTooBright = "too_bright"
+	RejectLowContrast = "low_contrast"
+	RejectBlurry = "blurry"
+)
+
+// the measures are taken on the frame shrunk to at most this width
+const qualitySampleWidth = 320
+
+// FrameQuality holds the mean (brightness) and standard deviation (contrast)
+// of the luminance of a frame on a 0-255 scale, and the variance of its
+// laplacian (sharpness)
+type FrameQuality struct {
+	Width      int
+	Height     int
+	Brightness float64
+	Contrast   float64
+	Sharpness  float64
+}
+
+func measureQuality(img image.Image) *FrameQuality {
+	bounds := img.Bounds()
+	fq := &FrameQuality{Width: bounds.Dx(), Height: bounds.Dy()}
+
+	width, height := fq.Width, fq.Height
+	if width > qualitySampleWidth {
+		height = height * qualitySampleWidth / width
+		width = qualitySampleWidth
+	}
+	if width < 3 || height < 3 {
+		return fq
+	}
+
+	// point sampled so that shrinking doesn't blur the frame
+	gray := make([]float64, width * height)
+	var sum float64
+	for y := 0; y < height; y++ {
+		sy := bounds.Min.Y + (2 * y + 1) * fq.Height / (2 * height)
+		for x := 0; x < width; x++ {
+			sx := bounds.Min.X + (2 * x + 1) * fq.Width / (2 * width)
+			r, g, b, _ := img.At(sx, sy).RGBA()
+			l := (0.299 * float64(r) + 0.587 * float64(g) + 0.114 * float64(b)) / 257
+			gray[y * width + x] = l
+			sum += l
+		}
+	}
+
+	n := float64(width * height)
+	fq.Brightness = sum / n
+
+	var variance float64
+	for _, l := range gray {
+		variance += (l - fq.Brightness) * (l - fq.Brightness)
+	}
+	fq.Contrast = math.Sqrt(variance / n)
+
+	var lapSum, lapSquares float64
+	for y := 1; y < height - 1; y++ {
+		for x := 1; x < width - 1; x++ {
+			i := y * width + x
+			lap := 4 * gray[i] - gray[i - 1] - gray[i + 1] - gray[i - width] - gray[i + width]
+			lapSum += lap
+			lapSquares += lap * lap
+		}
+	}
+	m := float64((width - 2) * (height - 2))
+	fq.Sharpness = lapSquares / m - (lapSum / m) * (lapSum / m)
+
+	return fq
+}
+
+// Reject returns the reason a frame of this quality is not worth analyzing,
+// or an empty string if it is
+func (fq *FrameQuality) Reject() string {
+	switch {
+	case fq.Width < conf.QualityMinWidth || fq.Height < conf.QualityMinHeight:
+		return RejectTooSmall
+	case fq.Brightness < conf.QualityMinBrightness:
+		return RejectTooDark
+	case fq.Brightness > conf.QualityMaxBrightness:
+		return RejectTooBright
+	case fq.Contrast < conf.QualityMinContrast:
+		return RejectLowContrast
+	case fq.Sharpness < conf.QualityMinSharpness:
+		return RejectBlurry
+	}
+
+	return ""
+}
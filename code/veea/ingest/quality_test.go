@@ -0,0 +1,36 @@
+package ingest
+
+import (
+	"image"
+	"testing"
+)
+
+func TestMeasureQuality(t *testing.T) {
+	tests := []struct {
+		name   string
+		img    image.Image
+		reason string
+	}{
+		{"textured", textured(320, 240, 1), ""},
+		{"large textured", textured(1280, 720, 2), ""},
+		{"too small", textured(40, 30, 3), RejectTooSmall},
+		{"too dark", flat(320, 240, 5), RejectTooDark},
+		{"too bright", flat(320, 240, 250), RejectTooBright},
+		{"flat", flat(320, 240, 128), RejectLowContrast},
+		{"blurry", gradient(320, 240, 60, 200), RejectBlurry},
+	}
+
+	for _, test := range tests {
+		fq := measureQuality(test.img)
+		if reason := fq.Reject(); reason != test.reason {
+			t.Errorf("%s: reject = %q, want %q (quality %+v)", test.name, reason, test.reason, *fq)
+		}
+	}
+}
+
+func TestMeasureQualitySize(t *testing.T) {
+	fq := measureQuality(textured(1280, 720, 4))
+	if fq.Width != 1280 || fq.Height != 720 {
+		t.Errorf("size = %dx%d, want the size of the frame before shrinking", fq.Width, fq.Height)
+	}
+}
@@ -0,0 +1,95 @@
+package ingest
+
+import (
+	"sync"
+	"errors"
+
+	"github.com/gpahal/veea/db"
+	"github.com/gpahal/veea/conf"
+	log "github.com/Sirupsen/logrus"
+)
+
+type Job struct {
+	Video      *db.Video
+	ViewTimeId int64
+	Image      []byte
+
+	// called with the final status once the frame is analyzed, if set
+	Done func(viewTimeStatus *db.ViewTimeStatus)
+}
+
+var ErrQueueFull = errors.New("Ingestion queue is full")
+
+// bounded queue of frames waiting to be analyzed by a fixed pool of workers
+type Queue struct {
+	jobs    chan *Job
+	workers int
+	once    sync.Once
+}
+
+func NewQueue(size int, workers int) *Queue {
+	return &Queue{
+		jobs: make(chan *Job, size),
+		workers: workers,
+	}
+}
+
+func (q *Queue) Start() {
+	q.once.Do(func() {
+		for i := 0; i < q.workers; i += 1 {
+			go q.work()
+		}
+	})
+}
+
+// Submit never blocks, a full queue sheds the job and returns ErrQueueFull
+func (q *Queue) Submit(job *Job) error {
+	select {
+	case q.jobs <- job:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+func (q *Queue) Len() int {
+	return len(q.jobs)
+}
+
+// Load is the fraction of the queue in use
+func (q *Queue) Load() float64 {
+	return float64(len(q.jobs)) / float64(cap(q.jobs))
+}
+
+func (q *Queue) work() {
+	for job := range q.jobs {
+		q.process(job)
+	}
+}
+
+func (q *Queue) process(job *Job) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.WithFields(log.Fields{
+				"viewTimeId": job.ViewTimeId,
+				"panic": r,
+			}).Error("Panic while analyzing frame")
+		}
+	}()
+
+	Process(job)
+}
+
+var defaultQueue = NewQueue(conf.IngestQueueSize, conf.IngestWorkers)
+
+func Start() {
+	defaultQueue.Start()
+}
+
+func Submit(job *Job) error {
+	return defaultQueue.Submit(job)
+}
+
+func Load() float64 {
+	return defaultQueue.Load()
+}
@@ -0,0 +1,79 @@
+package ingest
+
+import (
+	"github.com/gpahal/veea/db"
+	"github.com/gpahal/veea/framestore"
+	log "github.com/Sirupsen/logrus"
+)
+
+type ReanalyzeReport struct {
+	Frames   int
+	Replaced int
+	Skipped  int
+}
+
+// Reanalyze runs the archived frames matching the filter through the current
+// analyzer and replaces the stats rows of every frame that could be analyzed.
+// Frames that fail keep their old rows.
+func Reanalyze(filter *db.ViewTimeFilter) (*ReanalyzeReport, error) {
+	store, err := framestore.Default()
+	if err != nil {
+		return nil, err
+	}
+
+	viewFrames, err := db.GetViewFrames(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ReanalyzeReport{Frames: len(viewFrames)}
+	videos := map[string]*db.Video{}
+
+	for _, viewFrame := range viewFrames {
+		video, exists := videos[viewFrame.VideoId]
+		if !exists {
+			video, err = db.GetVideo(viewFrame.VideoId)
+			if err != nil {
+				return report, err
+			}
+			videos[viewFrame.VideoId] = video
+		}
+
+		image, err := store.Get(viewFrame.Hash)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"viewTimeId": viewFrame.ViewTimeId,
+				"error": err.Error(),
+			}).Warn("Archived frame is missing")
+			report.Skipped += 1
+			continue
+		}
+
+		a, err := analyze(video, viewFrame.ViewTimeId, image)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"viewTimeId": viewFrame.ViewTimeId,
+				"error": err.Error(),
+			}).Warn("Error reanalyzing frame")
+			report.Skipped += 1
+			continue
+		}
+
+		a.viewTimeStatus.PeopleSuccessCount = len(a.viewStatsList)
+		a.viewTimeStatus.Failures = EncodeFailures(a.failures)
+
+		err = db.ReplaceViewStats(a.viewTimeStatus, a.viewStatsList, TrackPersons)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"viewTimeId": viewFrame.ViewTimeId,
+				"error": err.Error(),
+			}).Warn("Error replacing view stats")
+			report.Skipped += 1
+			continue
+		}
+
+		report.Replaced += 1
+	}
+
+	return report, nil
+}
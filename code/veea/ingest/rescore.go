@@ -0,0 +1,95 @@
+package ingest
+
+import (
+	"github.com/gpahal/veea/db"
+	"github.com/gpahal/veea/conf"
+	"github.com/gpahal/veea/engagement"
+	log "github.com/Sirupsen/logrus"
+)
+
+// RunEngagementJob claims an engagement job and rescores its rows chunk by
+// chunk, progress is called after every committed chunk. It returns false if
+// the job is held by another process or already finished.
+func RunEngagementJob(id int64, progress func(job *db.EngagementJob)) (bool, error) {
+	claimed, err := db.ClaimEngagementJob(id)
+	if err != nil || !claimed {
+		return false, err
+	}
+
+	job, err := db.GetEngagementJob(id)
+	if err != nil {
+		return true, err
+	}
+
+	scorer, err := engagement.Get(job.EngagementModel)
+	if err != nil {
+		return true, db.FinishEngagementJob(id, err)
+	}
+
+	score := func(viewStats *db.ViewStats) float64 {
+		return scorer.Score(EngagementInput(viewStats))
+	}
+
+	for {
+		n, err := db.RescoreEngagementChunk(job, conf.EngagementChunkSize, score)
+		if err == db.ErrEngagementJobLeaseLost {
+			// the process that took over the job continues it
+			return true, err
+		}
+		if err != nil {
+			// the cursor of the last committed chunk is kept, the job resumes
+			// from there once its lease expires, unless the chunk keeps failing
+			attempts, attemptsErr := db.FailEngagementChunk(id)
+			if attemptsErr != nil {
+				return true, attemptsErr
+			}
+			if attempts >= conf.EngagementChunkMaxAttempts {
+				finishErr := db.FinishEngagementJob(id, err)
+				if finishErr != nil {
+					return true, finishErr
+				}
+			}
+			return true, err
+		}
+		if n == 0 {
+			break
+		}
+
+		if progress != nil {
+			progress(job)
+		}
+	}
+
+	return true, db.FinishEngagementJob(id, nil)
+}
+
+// RunEngagementJobs runs every pending engagement job and resumes the ones
+// abandoned by a stopped process
+func RunEngagementJobs() error {
+	ids, err := db.GetRunnableEngagementJobIds()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		_, err = RunEngagementJob(id, LogEngagementJobProgress)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"jobId": id,
+				"error": err.Error(),
+			}).Error("Error running engagement job")
+		}
+	}
+
+	return nil
+}
+
+func LogEngagementJobProgress(job *db.EngagementJob) {
+	log.WithFields(log.Fields{
+		"jobId": job.Id,
+		"videoId": job.VideoId,
+		"engagementModel": job.EngagementModel,
+		"processed": job.Processed,
+		"total": job.Total,
+	}).Info("Engagement job progress")
+}
@@ -0,0 +1,75 @@
+package ingest
+
+import (
+	"sort"
+	"math"
+
+	"github.com/gpahal/veea/db"
+	"github.com/gpahal/veea/conf"
+)
+
+type trackPair struct {
+	known    int
+	face     int
+	distance float64
+}
+
+type trackPairs []*trackPair
+
+func (tp trackPairs) Len() int           { return len(tp) }
+func (tp trackPairs) Less(i, j int) bool { return tp[i].distance < tp[j].distance }
+func (tp trackPairs) Swap(i, j int)      { tp[i], tp[j] = tp[j], tp[i] }
+
+// TrackPersons gives every face of a frame the person index of the closest
+// person seen earlier in the view. Pairs are matched greedily from the closest
+// one, so two faces never get the same person, and a face with no person
+// within TrackMaxDistance becomes a new person.
+func TrackPersons(known []*db.ViewStats, viewStatsList []*db.ViewStats, nextIndex int) {
+	pairs := trackPairs{}
+	for i, person := range known {
+		for j, viewStats := range viewStatsList {
+			distance := personDistance(person, viewStats)
+			if distance <= conf.TrackMaxDistance {
+				pairs = append(pairs, &trackPair{known: i, face: j, distance: distance})
+			}
+		}
+	}
+
+	sort.Sort(pairs)
+
+	knownMatched := make([]bool, len(known))
+	faceMatched := make([]bool, len(viewStatsList))
+
+	for _, pair := range pairs {
+		if knownMatched[pair.known] || faceMatched[pair.face] {
+			continue
+		}
+
+		knownMatched[pair.known] = true
+		faceMatched[pair.face] = true
+		viewStatsList[pair.face].PersonIndex = known[pair.known].PersonIndex
+	}
+
+	for j, viewStats := range viewStatsList {
+		if !faceMatched[j] {
+			viewStats.PersonIndex = nextIndex
+			nextIndex += 1
+		}
+	}
+}
+
+func personDistance(a *db.ViewStats, b *db.ViewStats) float64 {
+	dx := a.HeadX - b.HeadX
+	dy := a.HeadY - b.HeadY
+	dz := a.HeadZ - b.HeadZ
+
+	distance := math.Sqrt(dx * dx + dy * dy + dz * dz)
+	if a.Age >= 0 && b.Age >= 0 {
+		distance += math.Abs(float64(a.Age - b.Age)) * conf.TrackAgeWeight
+	}
+	if a.Gender * b.Gender < 0 {
+		distance += conf.TrackGenderPenalty
+	}
+
+	return distance
+}
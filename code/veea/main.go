@@ -7,25 +7,116 @@ import (
 
 	"github.com/gpahal/veea/resources"
 	"github.com/gin-gonic/gin"
-	"github.com/gpahal/veea/db"
 	log "github.com/Sirupsen/logrus"
 	"github.com/gpahal/veea/conf"
+	"github.com/gpahal/veea/analyzer"
+	"github.com/gpahal/veea/ingest"
+	"github.com/gpahal/veea/timeline"
+	"github.com/gpahal/veea/ratelimit"
+	"github.com/gpahal/veea/engagement"
 )
 
 func CheckPeriodically() {
 	for {
 		time.Sleep(5 * 60 * time.Second)
-		err := db.UpdateVideoDuration()
+		err := ingest.PurgeFrames()
 		if err != nil {
 			log.WithFields(log.Fields{
 				"error": err.Error(),
-			}).Error("Error updating video duration")
+			}).Error("Error purging archived frames")
+		}
+
+		err = ratelimit.Prune()
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error": err.Error(),
+			}).Error("Error pruning rate limit buckets")
+		}
+
+		err = timeline.Update()
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error": err.Error(),
+			}).Error("Error updating playback timelines")
+		}
+	}
+}
+
+func FinalizeViewsPeriodically() {
+	for {
+		time.Sleep(time.Duration(conf.ViewFinalizeInterval) * time.Second)
+		err := timeline.Finalize()
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error": err.Error(),
+			}).Error("Error finalizing views")
+		}
+	}
+}
+
+func RunEngagementJobsPeriodically() {
+	for {
+		time.Sleep(30 * time.Second)
+		err := ingest.RunEngagementJobs()
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error": err.Error(),
+			}).Error("Error running engagement jobs")
 		}
 	}
 }
 
 func main() {
+	otherPtr := flag.Bool("other", false, "choose the other port")
+	stubPtr := flag.Bool("stub", false, "use the local stub face analyzer")
+
+	reanalyzePtr := flag.Bool("reanalyze", false, "reanalyze archived frames with the current analyzer and exit")
+	videoPtr := flag.String("video", "", "video id of the frames to reanalyze or the stats to rescore")
+	viewPtr := flag.String("view", "", "view id of the frames to reanalyze")
+	fromPtr := flag.String("from", "", "reanalyze frames captured on or after this date (YYYY-MM-DD)")
+	toPtr := flag.String("to", "", "reanalyze frames captured before this date (YYYY-MM-DD)")
+
+	rescorePtr := flag.Bool("rescore", false, "recompute engagement of stored stats with -model and exit")
+	modelPtr := flag.String("model", "", "engagement model used to rescore")
+	jobPtr := flag.Int64("job", 0, "id of an engagement job to resume")
+
+	flag.Parse()
+
+	err := engagement.LoadModels()
+	if err != nil {
+		log.WithFields(log.Fields{
+			"error": err.Error(),
+		}).Fatal("Error loading engagement models")
+	}
+
+	if *stubPtr {
+		analyzer.Set(analyzer.NewStubAnalyzer())
+	}
+
+	if *reanalyzePtr {
+		err := Reanalyze(*videoPtr, *viewPtr, *fromPtr, *toPtr)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error": err.Error(),
+			}).Fatal("Error reanalyzing frames")
+		}
+		return
+	}
+
+	if *rescorePtr {
+		err := Rescore(*jobPtr, *videoPtr, *modelPtr)
+		if err != nil {
+			log.WithFields(log.Fields{
+				"error": err.Error(),
+			}).Fatal("Error recomputing engagement")
+		}
+		return
+	}
+
 	go CheckPeriodically()
+	go FinalizeViewsPeriodically()
+	go RunEngagementJobsPeriodically()
+	ingest.Start()
 
 	router := gin.Default()
 
@@ -49,13 +140,20 @@ func main() {
 		videoRouter.GET("/logout", resources.GetLogoutHandler)
 
 		videoRouter.GET("/watch", resources.AuthMiddleware, resources.GetVideoHandler)
+		videoRouter.POST("/consent", resources.AuthMiddleware, resources.ConsentHandler)
 
 		videoRouter.POST("/data", resources.AuthMiddleware, resources.GetDataHandler)
-	}
+		videoRouter.POST("/data/batch", resources.AuthMiddleware, resources.BatchDataHandler)
+		videoRouter.GET("/data/:viewTimeId", resources.AuthMiddleware, resources.GetDataStatusHandler)
 
-	otherPtr := flag.Bool("other", false, "choose the other port")
+		videoRouter.POST("/events", resources.AuthMiddleware, resources.EventsHandler)
 
-	flag.Parse()
+		videoRouter.POST("/view/start", resources.AuthMiddleware, resources.ViewStartHandler)
+		videoRouter.POST("/view/heartbeat", resources.AuthMiddleware, resources.ViewHeartbeatHandler)
+		videoRouter.POST("/view/end", resources.AuthMiddleware, resources.ViewEndHandler)
+
+		videoRouter.GET("/stream", resources.AuthMiddleware, resources.StreamHandler)
+	}
 
 	if *otherPtr {
 		router.Run(":8081")
@@ -0,0 +1,65 @@
+package privacy
+
+import (
+	"fmt"
+	"errors"
+)
+
+// privacy modes of a video, they decide which demographics of a face are
+// stored. Full keeps the exact age and gender, Bucketed keeps the gender and
+// only the age range and None keeps neither.
+const (
+	Full = "full"
+	Bucketed = "bucketed"
+	None = "none"
+)
+
+// mode of the videos that do not choose one
+const DefaultMode = Full
+
+// age ranges faces are bucketed into: <18, 18-30, 31-50, >50
+const AgeBucketCount = 4
+
+func Modes() []string {
+	return []string{Full, Bucketed, None}
+}
+
+func Validate(mode string) error {
+	for _, m := range Modes() {
+		if m == mode {
+			return nil
+		}
+	}
+
+	return errors.New(fmt.Sprintf("Privacy mode %s does not exist", mode))
+}
+
+// AgeBucket returns the index of the age range of an age, or -1 if the age is
+// unknown
+func AgeBucket(age int) int {
+	if age < 0 {
+		return -1
+	} else if age < 18 {
+		return 0
+	} else if age < 31 {
+		return 1
+	} else if age < 51 {
+		return 2
+	}
+	return 3
+}
+
+// KeepsGender reports if the gender of faces is stored in a mode
+func KeepsGender(mode string) bool {
+	return mode != None
+}
+
+// KeepsAge reports if the exact age of faces is stored in a mode
+func KeepsAge(mode string) bool {
+	return mode == Full
+}
+
+// KeepsAgeBucket reports if the age range of faces is stored in a mode
+func KeepsAgeBucket(mode string) bool {
+	return mode != None
+}
@@ -0,0 +1,60 @@
+package privacy
+
+import "testing"
+
+func TestAgeBucket(t *testing.T) {
+	tests := []struct {
+		age    int
+		bucket int
+	}{
+		{-1, -1},
+		{0, 0},
+		{17, 0},
+		{18, 1},
+		{30, 1},
+		{31, 2},
+		{50, 2},
+		{51, 3},
+		{90, 3},
+	}
+
+	for _, test := range tests {
+		bucket := AgeBucket(test.age)
+		if bucket != test.bucket {
+			t.Errorf("AgeBucket(%d) = %d, want %d", test.age, bucket, test.bucket)
+		}
+		if bucket >= AgeBucketCount {
+			t.Errorf("AgeBucket(%d) = %d is not below AgeBucketCount", test.age, bucket)
+		}
+	}
+}
+
+func TestModes(t *testing.T) {
+	tests := []struct {
+		mode      string
+		valid     bool
+		gender    bool
+		age       bool
+		ageBucket bool
+	}{
+		{Full, true, true, true, true},
+		{Bucketed, true, true, false, true},
+		{None, true, false, false, false},
+		{"partial", false, true, false, true},
+	}
+
+	for _, test := range tests {
+		if (Validate(test.mode) == nil) != test.valid {
+			t.Errorf("Validate(%q) valid = %v, want %v", test.mode, !test.valid, test.valid)
+		}
+		if KeepsGender(test.mode) != test.gender {
+			t.Errorf("KeepsGender(%q) = %v, want %v", test.mode, !test.gender, test.gender)
+		}
+		if KeepsAge(test.mode) != test.age {
+			t.Errorf("KeepsAge(%q) = %v, want %v", test.mode, !test.age, test.age)
+		}
+		if KeepsAgeBucket(test.mode) != test.ageBucket {
+			t.Errorf("KeepsAgeBucket(%q) = %v, want %v", test.mode, !test.ageBucket, test.ageBucket)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+	"math"
+
+	"github.com/gpahal/veea/db"
+	"github.com/gpahal/veea/conf"
+	log "github.com/Sirupsen/logrus"
+)
+
+// Store keeps the token buckets of a limiter. Take removes n tokens from the
+// bucket of key if it has them, and otherwise returns how long to wait until
+// it will. Refund puts back n tokens taken by a request that didn't go ahead.
+type Store interface {
+	Take(key string, n float64, rate float64, burst float64) (bool, time.Duration, error)
+	Refund(key string, n float64, rate float64, burst float64) error
+}
+
+// Limiter is a token bucket per key, every bucket holds at most Burst tokens
+// and gains Rate tokens per second
+type Limiter struct {
+	Name  string
+	Rate  float64
+	Burst float64
+	Store Store
+}
+
+func NewLimiter(name string, rate float64, burst float64, store Store) *Limiter {
+	return &Limiter{
+		Name: name,
+		Rate: rate,
+		Burst: burst,
+		Store: store,
+	}
+}
+
+// Allow takes n tokens for key, a store error lets the request through
+func (l *Limiter) Allow(key string, n float64) (bool, time.Duration) {
+	allowed, retryAfter, err := l.Store.Take(l.Name + ":" + key, n, l.Rate, l.Burst)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"limiter": l.Name,
+			"key": key,
+			"error": err.Error(),
+		}).Error("Error taking rate limit tokens")
+		return true, 0
+	}
+
+	return allowed, retryAfter
+}
+
+// Refund puts back n tokens taken for key by Allow
+func (l *Limiter) Refund(key string, n float64) {
+	err := l.Store.Refund(l.Name + ":" + key, n, l.Rate, l.Burst)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"limiter": l.Name,
+			"key": key,
+			"error": err.Error(),
+		}).Error("Error refunding rate limit tokens")
+	}
+}
+
+// take refills a bucket for the elapsed seconds and removes n tokens from it
+// if it can, returning the new number of tokens
+func take(tokens float64, elapsed float64, n float64, rate float64, burst float64) (float64, bool, time.Duration) {
+	tokens = math.Min(burst, tokens + math.Max(elapsed, 0) * rate)
+	if tokens >= n {
+		return tokens - n, true, 0
+	}
+
+	if rate <= 0 {
+		return tokens, false, time.Hour
+	}
+
+	// a request bigger than the bucket never passes, it is told to wait for a
+	// full bucket so that it is retried in smaller parts
+	wait := (math.Min(n, burst) - tokens) / rate
+	return tokens, false, time.Duration(wait * float64(time.Second))
+}
+
+// refund refills a bucket for the elapsed seconds and puts n tokens back into
+// it, returning the new number of tokens
+func refund(tokens float64, elapsed float64, n float64, rate float64, burst float64) float64 {
+	return math.Min(burst, tokens + math.Max(elapsed, 0) * rate + n)
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// MemoryStore keeps the buckets in the process, each veea instance then
+// limits on its own
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*bucket)}
+}
+
+func (ms *MemoryStore) Take(key string, n float64, rate float64, burst float64) (bool, time.Duration, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	now := time.Now()
+	b, ok := ms.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		ms.buckets[key] = b
+	}
+
+	tokens, allowed, retryAfter := take(b.tokens, now.Sub(b.last).Seconds(), n, rate, burst)
+	b.tokens = tokens
+	b.last = now
+
+	return allowed, retryAfter, nil
+}
+
+func (ms *MemoryStore) Refund(key string, n float64, rate float64, burst float64) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	b, ok := ms.buckets[key]
+	if !ok {
+		return nil
+	}
+
+	now := time.Now()
+	b.tokens = refund(b.tokens, now.Sub(b.last).Seconds(), n, rate, burst)
+	b.last = now
+
+	return nil
+}
+
+// Prune forgets the buckets not used for idle, they are full again by then
+// for any sensible rate
+func (ms *MemoryStore) Prune(idle time.Duration) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	cutoff := time.Now().Add(-idle)
+	for key, b := range ms.buckets {
+		if b.last.Before(cutoff) {
+			delete(ms.buckets, key)
+		}
+	}
+}
+
+// DbStore keeps the buckets in the database so that every veea instance
+// behind the load balancer shares them
+type DbStore struct{}
+
+func (ds *DbStore) Take(key string, n float64, rate float64, burst float64) (bool, time.Duration, error) {
+	var allowed bool
+	var retryAfter time.Duration
+
+	err := db.TakeRateLimitTokens(key, burst, func(tokens float64, elapsed float64) float64 {
+		tokens, allowed, retryAfter = take(tokens, elapsed, n, rate, burst)
+		return tokens
+	})
+	if err != nil {
+		return false, 0, err
+	}
+
+	return allowed, retryAfter, nil
+}
+
+func (ds *DbStore) Refund(key string, n float64, rate float64, burst float64) error {
+	return db.TakeRateLimitTokens(key, burst, func(tokens float64, elapsed float64) float64 {
+		return refund(tokens, elapsed, n, rate, burst)
+	})
+}
+
+var (
+	memoryStore = NewMemoryStore()
+
+	// frames a single view can submit
+	ViewLimiter *Limiter
+	// frames all the views of a user can submit together
+	UserLimiter *Limiter
+)
+
+func init() {
+	var store Store = memoryStore
+	if conf.RateLimitShared {
+		store = &DbStore{}
+	}
+
+	ViewLimiter = NewLimiter("view", conf.RateLimitViewRate, conf.RateLimitViewBurst, store)
+	UserLimiter = NewLimiter("user", conf.RateLimitUserRate, conf.RateLimitUserBurst, store)
+}
+
+// Prune forgets idle buckets of the local store and of the shared one if it
+// is used
+func Prune() error {
+	memoryStore.Prune(time.Hour)
+
+	if conf.RateLimitShared {
+		_, err := db.DeleteIdleRateLimitBuckets(time.Hour)
+		return err
+	}
+
+	return nil
+}
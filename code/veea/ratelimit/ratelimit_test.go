@@ -0,0 +1,83 @@
+package ratelimit
+
+import (
+	"time"
+	"testing"
+)
+
+func TestTake(t *testing.T) {
+	tests := []struct {
+		name       string
+		tokens     float64
+		elapsed    float64
+		n          float64
+		rate       float64
+		burst      float64
+		left       float64
+		allowed    bool
+		retryAfter time.Duration
+	}{
+		{"full bucket", 10, 0, 1, 1, 10, 9, true, 0},
+		{"refilled", 0, 2, 2, 1, 10, 0, true, 0},
+		{"refill capped at burst", 5, 100, 1, 1, 10, 9, true, 0},
+		{"clock going back", 3, -5, 1, 1, 10, 2, true, 0},
+		{"exhausted", 0.5, 0, 1, 2, 10, 0.5, false, 250 * time.Millisecond},
+		{"larger than the bucket", 10, 0, 20, 5, 10, 10, false, 0},
+		{"no rate", 0, 10, 1, 0, 10, 0, false, time.Hour},
+	}
+
+	for _, test := range tests {
+		left, allowed, retryAfter := take(test.tokens, test.elapsed, test.n, test.rate, test.burst)
+		if left != test.left || allowed != test.allowed || retryAfter != test.retryAfter {
+			t.Errorf("%s: take = (%v, %v, %v), want (%v, %v, %v)", test.name, left, allowed, retryAfter, test.left, test.allowed, test.retryAfter)
+		}
+	}
+}
+
+func TestRefund(t *testing.T) {
+	tests := []struct {
+		name    string
+		tokens  float64
+		elapsed float64
+		n       float64
+		left    float64
+	}{
+		{"put back", 4, 0, 2, 6},
+		{"refilled and put back", 4, 2, 2, 8},
+		{"capped at burst", 9, 0, 5, 10},
+	}
+
+	for _, test := range tests {
+		left := refund(test.tokens, test.elapsed, test.n, 1, 10)
+		if left != test.left {
+			t.Errorf("%s: refund = %v, want %v", test.name, left, test.left)
+		}
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	ms := NewMemoryStore()
+
+	for i := 0; i < 3; i++ {
+		allowed, _, _ := ms.Take("view:1", 1, 0.001, 3)
+		if !allowed {
+			t.Fatalf("take %d was denied", i)
+		}
+	}
+
+	allowed, retryAfter, _ := ms.Take("view:1", 1, 0.001, 3)
+	if allowed || retryAfter <= 0 {
+		t.Errorf("take of an empty bucket = (%v, %v), want a denial with a wait", allowed, retryAfter)
+	}
+
+	allowed, _, _ = ms.Take("view:2", 1, 0.001, 3)
+	if !allowed {
+		t.Errorf("buckets of other keys are shared")
+	}
+
+	ms.Refund("view:1", 1, 0.001, 3)
+	allowed, _, _ = ms.Take("view:1", 1, 0.001, 3)
+	if !allowed {
+		t.Errorf("refunded token could not be taken")
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"time"
+	"errors"
+
+	"github.com/gpahal/veea/db"
+	"github.com/gpahal/veea/ingest"
+	log "github.com/Sirupsen/logrus"
+)
+
+const dateLayout = "2006-01-02"
+
+// Reanalyze reprocesses the archived frames of a video, a view or a date range
+// with the current analyzer
+func Reanalyze(videoId string, viewId string, from string, to string) error {
+	filter := &db.ViewTimeFilter{
+		VideoId: videoId,
+		ViewId: viewId,
+	}
+
+	var err error
+	if from != "" {
+		filter.From, err = time.ParseInLocation(dateLayout, from, time.Local)
+		if err != nil {
+			return errors.New("-from must be a date of the form YYYY-MM-DD")
+		}
+	}
+	if to != "" {
+		filter.To, err = time.ParseInLocation(dateLayout, to, time.Local)
+		if err != nil {
+			return errors.New("-to must be a date of the form YYYY-MM-DD")
+		}
+	}
+
+	if filter.VideoId == "" && filter.ViewId == "" && filter.From.IsZero() && filter.To.IsZero() {
+		return errors.New("at least one of -video, -view, -from or -to is required")
+	}
+
+	report, err := ingest.Reanalyze(filter)
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"frames": report.Frames,
+		"replaced": report.Replaced,
+		"skipped": report.Skipped,
+	}).Info("Reanalysis finished")
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/gpahal/veea/db"
+	"github.com/gpahal/veea/ingest"
+	"github.com/gpahal/veea/engagement"
+	log "github.com/Sirupsen/logrus"
+)
+
+// Rescore recomputes the engagement of the stats rows of a video (or of every
+// video if videoId is empty) with the given model. A non zero jobId resumes an
+// earlier job instead of creating a new one.
+func Rescore(jobId int64, videoId string, model string) error {
+	if jobId == 0 {
+		if model == "" {
+			return errors.New("-model is required unless -job is given")
+		}
+
+		_, err := engagement.Get(model)
+		if err != nil {
+			return err
+		}
+
+		jobId, err = db.CreateEngagementJob(videoId, model)
+		if err != nil {
+			return err
+		}
+	}
+
+	claimed, err := ingest.RunEngagementJob(jobId, ingest.LogEngagementJobProgress)
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		return errors.New("engagement job is finished or running in another process")
+	}
+
+	job, err := db.GetEngagementJob(jobId)
+	if err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"jobId": job.Id,
+		"processed": job.Processed,
+		"error": job.Error,
+	}).Info("Engagement job finished")
+
+	return nil
+}
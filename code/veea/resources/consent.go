@@ -0,0 +1,48 @@
+package resources
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gpahal/veea/db"
+)
+
+func ConsentHandler(c *gin.Context) {
+	path := GetPath(c)
+	user := GetUser(c)
+	var form struct {
+		Version int64 `form:"version" binding:"required"`
+		Accept  string `form:"accept" binding:"required"`
+	}
+
+	if c.Bind(&form) != nil {
+		renderConsent(c, "Input Error: please accept the consent text to continue")
+		return
+	}
+
+	_, err := db.AcceptConsent(user.Id, form.Version)
+	if err != nil {
+		renderConsent(c, ErrorPrefix(err) + ": " + err.Error())
+		return
+	}
+
+	c.Redirect(http.StatusFound, path + "/watch")
+}
+
+func renderConsent(c *gin.Context, message string) {
+	path := GetPath(c)
+
+	consentText, err := db.GetCurrentConsentText()
+	if err != nil {
+		c.HTML(http.StatusOK, "internal_error.html", gin.H{
+			"Path"   : path,
+		})
+		return
+	}
+
+	c.HTML(http.StatusOK, "consent.html", gin.H{
+		"Path"   : path,
+		"Message": message,
+		"Consent": consentText,
+	})
+}
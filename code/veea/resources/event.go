@@ -0,0 +1,88 @@
+package resources
+
+import (
+	"fmt"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gpahal/veea/conf"
+	"github.com/gpahal/veea/db"
+)
+
+type Event struct {
+	Type       string `json:"type" binding:"required"`
+	VideoTime  float64 `json:"videoTime"`
+	ClientTime int64 `json:"clientTime" binding:"required"`
+	From       float64 `json:"from"`
+	To         float64 `json:"to"`
+	Quality    string `json:"quality"`
+	Rate       float64 `json:"rate"`
+}
+
+type EventData struct {
+	ViewId string `json:"viewId" binding:"required"`
+	Events []*Event `json:"events" binding:"required"`
+}
+
+func EventsHandler(c *gin.Context) {
+	video := GetVideo(c)
+	user := GetUser(c)
+	var form EventData
+
+	if c.BindJSON(&form) == nil {
+		if len(form.Events) > conf.EventsMaxBatch {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("a request can have %d or less events", conf.EventsMaxBatch),
+			})
+			return
+		}
+
+		viewEvents, err := ViewEvents(form.Events)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{})
+			return
+		}
+
+		err = db.AddViewEvents(user.Id, video.VideoId, form.ViewId, viewEvents)
+		if err != nil {
+			switch err.(type) {
+			case *db.UserError:
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error": err.Error(),
+				})
+				return
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{})
+				return
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"count": len(viewEvents),
+		})
+	} else {
+		c.JSON(http.StatusBadRequest, gin.H{})
+	}
+}
+
+func ViewEvents(events []*Event) ([]*db.ViewEvent, error) {
+	viewEvents := make([]*db.ViewEvent, 0, len(events))
+	for _, event := range events {
+		if event == nil {
+			return nil, errors.New("event must not be null")
+		}
+
+		viewEvents = append(viewEvents, &db.ViewEvent{
+			Type: event.Type,
+			VideoTime: event.VideoTime,
+			ClientTime: event.ClientTime,
+			From: event.From,
+			To: event.To,
+			Quality: event.Quality,
+			Rate: event.Rate,
+		})
+	}
+
+	return viewEvents, nil
+}
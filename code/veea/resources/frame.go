@@ -0,0 +1,131 @@
+package resources
+
+import (
+	"errors"
+	"strconv"
+	"net/http"
+	"io/ioutil"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gpahal/veea/conf"
+)
+
+// ParseFrameRequest reads a single frame from a json body with a data url
+// image, a multipart form with an image file or a raw jpeg body with the view
+// metadata in headers
+func ParseFrameRequest(c *gin.Context) (string, *Frame, error) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, conf.MaxFrameSize)
+
+	switch c.ContentType() {
+	case "multipart/form-data":
+		return parseMultipartFrame(c)
+	case "image/jpeg":
+		return parseRawFrame(c)
+	default:
+		return parseJSONFrame(c)
+	}
+}
+
+func parseJSONFrame(c *gin.Context) (string, *Frame, error) {
+	var form Data
+
+	err := c.BindJSON(&form)
+	if err != nil {
+		return "", nil, err
+	}
+
+	frame, err := form.Frame()
+	if err != nil {
+		return "", nil, err
+	}
+
+	return form.ViewId, frame, nil
+}
+
+func parseMultipartFrame(c *gin.Context) (string, *Frame, error) {
+	viewId := c.PostForm("viewId")
+
+	frame, err := parseFrameMetadata(c.PostForm("seq"), c.PostForm("clientTime"), c.PostForm("time"), c.PostForm("state"), c.PostForm("quality"))
+	if err != nil {
+		return "", nil, err
+	}
+
+	frame.ImageNull = c.PostForm("imageNull") == "true"
+	if !frame.ImageNull {
+		file, _, err := c.Request.FormFile("image")
+		if err != nil {
+			return "", nil, err
+		}
+		defer file.Close()
+
+		frame.Image, err = ioutil.ReadAll(file)
+		if err != nil {
+			return "", nil, err
+		}
+		if len(frame.Image) == 0 {
+			return "", nil, errors.New("image must not be empty unless imageNull is set")
+		}
+	}
+
+	return viewId, frame, validateFrameRequest(viewId, frame)
+}
+
+func parseRawFrame(c *gin.Context) (string, *Frame, error) {
+	header := c.Request.Header
+	viewId := header.Get("X-View-Id")
+
+	frame, err := parseFrameMetadata(header.Get("X-Sequence"), header.Get("X-Client-Time"), header.Get("X-Video-Time"), header.Get("X-Player-State"), header.Get("X-Playback-Quality"))
+	if err != nil {
+		return "", nil, err
+	}
+
+	frame.Image, err = ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		return "", nil, err
+	}
+	frame.ImageNull = len(frame.Image) == 0
+
+	return viewId, frame, validateFrameRequest(viewId, frame)
+}
+
+func parseFrameMetadata(seqString string, clientTimeString string, timeString string, stateString string, quality string) (*Frame, error) {
+	var seq int64
+	var err error
+	if seqString != "" {
+		seq, err = strconv.ParseInt(seqString, 10, 64)
+		if err != nil || seq < 0 {
+			return nil, errors.New("seq must be a non negative integer")
+		}
+	}
+
+	var clientTime int64
+	if clientTimeString != "" {
+		clientTime, err = strconv.ParseInt(clientTimeString, 10, 64)
+		if err != nil || clientTime < 0 {
+			return nil, errors.New("client time must be a non negative integer")
+		}
+	}
+
+	time, err := strconv.ParseFloat(timeString, 64)
+	if err != nil {
+		return nil, errors.New("time must be a number")
+	}
+
+	state, err := strconv.Atoi(stateString)
+	if err != nil {
+		return nil, errors.New("state must be an integer")
+	}
+
+	return &Frame{Seq: seq, ClientTime: clientTime, Time: time, State: state, Quality: quality}, nil
+}
+
+func validateFrameRequest(viewId string, frame *Frame) error {
+	if viewId == "" {
+		return errors.New("view id is required")
+	}
+	if frame.Quality == "" {
+		return errors.New("quality is required")
+	}
+
+	return nil
+}
@@ -0,0 +1,51 @@
+package resources
+
+import (
+	"math"
+	"strconv"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gpahal/veea/ratelimit"
+)
+
+// allowFrames takes tokens for n frames from the limiters of the view and of
+// the user. If either is exhausted it responds with a 429 and a Retry-After
+// header the player backs off by, and returns false.
+func allowFrames(c *gin.Context, viewId string, n int) bool {
+	user := GetUser(c)
+
+	allowed, seconds := takeFrameTokens(user.Id, viewId, n)
+	if allowed {
+		return true
+	}
+
+	c.Header("Retry-After", strconv.FormatInt(seconds, 10))
+	SendDataResultJSON(c, http.StatusTooManyRequests, &DataResult{RetryAfter: seconds})
+
+	return false
+}
+
+// takeFrameTokens takes tokens for n frames from the limiters of the view and
+// of the user, returning the whole seconds to wait if either is exhausted.
+// The tokens of the view are put back if the user's limiter denies, so a
+// denied request costs nothing.
+func takeFrameTokens(userId int64, viewId string, n int) (bool, int64) {
+	allowed, retryAfter := ratelimit.ViewLimiter.Allow(viewId, float64(n))
+	if allowed {
+		allowed, retryAfter = ratelimit.UserLimiter.Allow(strconv.FormatInt(userId, 10), float64(n))
+		if !allowed {
+			ratelimit.ViewLimiter.Refund(viewId, float64(n))
+		}
+	}
+	if allowed {
+		return true, 0
+	}
+
+	seconds := int64(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+
+	return false, seconds
+}
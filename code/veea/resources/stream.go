@@ -0,0 +1,244 @@
+package resources
+
+import (
+	"sync"
+	"time"
+	"math"
+	"net/http"
+	"encoding/json"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/gpahal/veea/conf"
+	"github.com/gpahal/veea/db"
+	"github.com/gpahal/veea/ingest"
+	log "github.com/Sirupsen/logrus"
+)
+
+// StreamMessage is a text message sent by the player over the stream. A frame
+// with Binary set has its jpeg image in the binary message that follows it.
+type StreamMessage struct {
+	Type string `json:"type"`
+	Frame
+	Binary bool `json:"binary"`
+	Events []*Event `json:"events"`
+}
+
+const (
+	streamPongWait = 60 * time.Second
+	streamPingPeriod = 30 * time.Second
+	streamWriteWait = 10 * time.Second
+	streamSendBuffer = 64
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize: 4096,
+	WriteBufferSize: 4096,
+}
+
+type stream struct {
+	conn     *websocket.Conn
+	video    *db.Video
+	userId   int64
+	viewId   string
+	send     chan gin.H
+	done     chan struct{}
+	once     sync.Once
+	interval int64
+}
+
+// StreamHandler upgrades to a websocket over which the player of a view sends
+// frames and player events. The server answers every frame with an "ack",
+// pushes a "result" once the frame is analyzed and sends "cadence" hints with
+// the interval the player should capture frames at.
+func StreamHandler(c *gin.Context) {
+	video := GetVideo(c)
+	user := GetUser(c)
+	viewId := c.Query("viewId")
+
+	err := db.ViewIdNotExpiredExists(video.VideoId, viewId)
+	if err == nil {
+		err = db.ViewIdOfUser(viewId, user.Id)
+	}
+	if err == nil {
+		err = db.ViewIdConsented(viewId)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		return
+	}
+
+	s := &stream{
+		conn: conn,
+		video: video,
+		userId: user.Id,
+		viewId: viewId,
+		send: make(chan gin.H, streamSendBuffer),
+		done: make(chan struct{}),
+	}
+
+	go s.write()
+	s.hintCadence()
+	s.read()
+}
+
+func (s *stream) close() {
+	s.once.Do(func() {
+		close(s.done)
+		s.conn.Close()
+	})
+}
+
+// push queues a message for the player, it never blocks the analysis workers
+// so messages to a player that doesn't keep up are dropped
+func (s *stream) push(message gin.H) {
+	select {
+	case <-s.done:
+	case s.send <- message:
+	default:
+		log.WithFields(log.Fields{
+			"viewId": s.viewId,
+			"type": message["type"],
+		}).Warn("Dropped stream message")
+	}
+}
+
+func (s *stream) write() {
+	ticker := time.NewTicker(streamPingPeriod)
+	defer ticker.Stop()
+	defer s.close()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case message := <-s.send:
+			s.conn.SetWriteDeadline(time.Now().Add(streamWriteWait))
+			err := s.conn.WriteJSON(message)
+			if err != nil {
+				return
+			}
+		case <-ticker.C:
+			s.conn.SetWriteDeadline(time.Now().Add(streamWriteWait))
+			err := s.conn.WriteMessage(websocket.PingMessage, nil)
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (s *stream) read() {
+	defer s.close()
+
+	// a data url is a third bigger than the image it holds
+	s.conn.SetReadLimit(conf.MaxFrameSize * 2)
+	s.conn.SetReadDeadline(time.Now().Add(streamPongWait))
+	s.conn.SetPongHandler(func(string) error {
+		s.conn.SetReadDeadline(time.Now().Add(streamPongWait))
+		return nil
+	})
+
+	var pending *StreamMessage
+
+	for {
+		messageType, data, err := s.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		s.conn.SetReadDeadline(time.Now().Add(streamPongWait))
+
+		if messageType == websocket.BinaryMessage {
+			if pending == nil {
+				s.push(gin.H{"type": "error", "error": "binary message without a frame"})
+				continue
+			}
+
+			pending.Frame.Image = data
+			pending.Frame.ImageNull = len(data) == 0
+			s.frame(&pending.Frame)
+			pending = nil
+			continue
+		}
+
+		var message StreamMessage
+		err = json.Unmarshal(data, &message)
+		if err != nil {
+			s.push(gin.H{"type": "error", "error": "invalid message"})
+			continue
+		}
+
+		switch message.Type {
+		case "frame":
+			if message.Binary {
+				pending = &message
+				continue
+			}
+			s.frame(&message.Frame)
+		case "events":
+			s.events(message.Events)
+		default:
+			s.push(gin.H{"type": "error", "error": "unknown message type"})
+		}
+	}
+}
+
+func (s *stream) frame(frame *Frame) {
+	seq := frame.Seq
+
+	if frame.Quality == "" {
+		s.push(gin.H{"type": "ack", "seq": seq, "code": http.StatusBadRequest, "result": DataResultJSON(&DataResult{})})
+		return
+	}
+
+	allowed, retryAfter := takeFrameTokens(s.userId, s.viewId, 1)
+	if !allowed {
+		s.push(gin.H{"type": "ack", "seq": seq, "code": http.StatusTooManyRequests, "retryAfter": retryAfter, "result": DataResultJSON(&DataResult{RetryAfter: retryAfter})})
+		return
+	}
+
+	code, dr := IngestFrameNotify(s.video, s.viewId, frame, func(viewTimeStatus *db.ViewTimeStatus) {
+		s.push(gin.H{"type": "result", "seq": seq, "result": DataResultJSON(DataResultFromStatus(viewTimeStatus))})
+	})
+
+	s.push(gin.H{"type": "ack", "seq": seq, "code": code, "retryAfter": dr.RetryAfter, "result": DataResultJSON(dr)})
+	s.hintCadence()
+}
+
+func (s *stream) events(events []*Event) {
+	if len(events) > conf.EventsMaxBatch {
+		s.push(gin.H{"type": "error", "error": "too many events"})
+		return
+	}
+
+	viewEvents, err := ViewEvents(events)
+	if err == nil {
+		err = db.AddViewEvents(s.userId, s.video.VideoId, s.viewId, viewEvents)
+	}
+	if err != nil {
+		s.push(gin.H{"type": "error", "error": "unable to store events"})
+	}
+}
+
+// hintCadence tells the player to capture frames less often as the ingestion
+// queue fills up, never faster than the rate limit of a view allows
+func (s *stream) hintCadence() {
+	interval := float64(conf.StreamFrameInterval) * (1 + 3 * ingest.Load())
+	interval = math.Max(interval, 1000 / conf.RateLimitViewRate)
+	interval = math.Min(interval, float64(conf.StreamMaxFrameInterval))
+
+	rounded := int64(interval / 100) * 100
+	if rounded == s.interval {
+		return
+	}
+
+	s.interval = rounded
+	s.push(gin.H{"type": "cadence", "interval": rounded})
+}
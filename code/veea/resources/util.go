@@ -9,7 +9,6 @@ import (
 
 	"github.com/gpahal/veea/db"
 	"github.com/gin-gonic/gin"
-	"math"
 )
 
 func DefaultQueryInt(c *gin.Context, key string, defaultValue int) (int, error) {
@@ -113,21 +112,18 @@ func GetPath(c *gin.Context) string {
 }
 
 func SendDataResultJSON(c *gin.Context, code int, dr *DataResult) {
-	c.JSON(code, gin.H{
+	c.JSON(code, DataResultJSON(dr))
+}
+
+func DataResultJSON(dr *DataResult) gin.H {
+	return gin.H{
 		"status": dr.Status,
+		"viewTimeId": dr.ViewTimeId,
 		"peopleCount": dr.PeopleCount,
 		"peopleSuccessCount": dr.PeopleSuccessCount,
-	})
-}
-
-func Norm2(values ...float64) float64 {
-	var result float64 = 0
-
-	for _, value := range values {
-		result += value * value
+		"failures": dr.Failures,
+		"flag": dr.Flag,
+		"replayed": dr.Replayed,
+		"retryAfter": dr.RetryAfter,
 	}
-
-	result = result / float64(len(values))
-
-	return math.Sqrt(result)
 }
\ No newline at end of file
@@ -2,32 +2,99 @@ package resources
 
 import (
 	"fmt"
+	"errors"
+	"math"
 	"time"
+	"strconv"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gpahal/veea/conf"
 	"github.com/gpahal/veea/db"
 	"github.com/vincent-petithory/dataurl"
-	"io/ioutil"
-	"net/url"
-	"strings"
-	"encoding/json"
+	"github.com/gpahal/veea/analyzer"
+	"github.com/gpahal/veea/ingest"
 )
 
+// Data is a single frame upload, its frame is validated the same way as the
+// frames of a batch upload
 type Data struct {
-	ViewId    string `json:"viewId" binding:"required"`
-	Time      float64 `json:"time" binding:"required"`
-	State     int `json:"state" binding:"required"`
-	Quality   string `json:"quality" binding:"required"`
+	ViewId string `json:"viewId" binding:"required"`
+	BatchFrame
+}
+
+// Frame is a captured frame, ClientTime is the time it was captured at on the
+// client in milliseconds since the epoch (0 if the player doesn't send it)
+type Frame struct {
+	Seq        int64 `json:"seq"`
+	ClientTime int64 `json:"clientTime"`
+	Time      float64 `json:"time"`
+	State     int `json:"state"`
+	Quality   string `json:"quality"`
 	ImageNull bool `json:"imageNull"`
-	ImageData string `json:"imageData" binding:"required"`
+	ImageData string `json:"imageData"`
+
+	// decoded image of frames not uploaded as a data url
+	Image []byte `json:"-"`
+}
+
+type BatchData struct {
+	ViewId string `json:"viewId" binding:"required"`
+	Frames []*BatchFrame `json:"frames" binding:"required"`
+}
+
+// BatchFrame is a frame of a batch upload, time and state are pointers so a
+// frame missing them is told apart from one at time 0 or state 0
+type BatchFrame struct {
+	Seq        int64 `json:"seq"`
+	ClientTime int64 `json:"clientTime"`
+	Time      *float64 `json:"time"`
+	State     *int `json:"state"`
+	Quality   string `json:"quality"`
+	ImageNull bool `json:"imageNull"`
+	ImageData string `json:"imageData"`
+}
+
+// Frame returns the frame of a batch upload, or an error if it misses a
+// field the single frame upload requires
+func (batchFrame *BatchFrame) Frame() (*Frame, error) {
+	if batchFrame == nil {
+		return nil, errors.New("frame must not be null")
+	}
+	if batchFrame.Time == nil || batchFrame.State == nil || batchFrame.Quality == "" {
+		return nil, errors.New("time, state and quality are required")
+	}
+	if !batchFrame.ImageNull && batchFrame.ImageData == "" {
+		return nil, errors.New("image data is required")
+	}
+
+	return &Frame{
+		Seq: batchFrame.Seq,
+		ClientTime: batchFrame.ClientTime,
+		Time: *batchFrame.Time,
+		State: *batchFrame.State,
+		Quality: batchFrame.Quality,
+		ImageNull: batchFrame.ImageNull,
+		ImageData: batchFrame.ImageData,
+	}, nil
 }
 
 type DataResult struct {
 	Status int
+	ViewTimeId int64
 	PeopleCount int
 	PeopleSuccessCount int
+	Failures []*analyzer.FaceFailure
+	// reason the frame's sample was flagged as implausible, if it was
+	Flag string
+
+	// set if the frame's sequence number was already submitted, the result
+	// is then the one of the original submission
+	Replayed bool
+
+	// seconds the player should wait before sending frames again, set with
+	// status ViewTimeStatusUnavailable while the analyzer is down
+	RetryAfter int64
 }
 
 func GetIndexHandler(c *gin.Context) {
@@ -41,7 +108,42 @@ func GetVideoHandler(c *gin.Context)  {
 	path := GetPath(c)
 	user := GetUser(c)
 
-	viewId, err := db.AddVideoView(user.Id, video.VideoId)
+	// no view id (and so no webcam capture) without consent to the current
+	// consent text
+	consentText, err := db.GetCurrentConsentText()
+	if err != nil {
+		switch err.(type) {
+		case *db.UserError:
+			c.HTML(http.StatusOK, "consent.html", gin.H{
+				"Path"   : path,
+				"Message": "Watching is not available yet: " + err.Error(),
+			})
+			return
+		default:
+			c.HTML(http.StatusOK, "internal_error.html", gin.H{
+				"Path"   : path,
+			})
+			return
+		}
+	}
+
+	consentId, found, err := db.GetConsentId(user.Id, consentText.Version)
+	if err != nil {
+		c.HTML(http.StatusOK, "internal_error.html", gin.H{
+			"Path"   : path,
+		})
+		return
+	}
+	if !found {
+		c.HTML(http.StatusOK, "consent.html", gin.H{
+			"Path"   : path,
+			"Message": "",
+			"Consent": consentText,
+		})
+		return
+	}
+
+	viewId, err := db.AddVideoView(user.Id, video.VideoId, consentId)
 	if err != nil {
 		switch err.(type) {
 		case *db.UserError:
@@ -62,146 +164,257 @@ func GetVideoHandler(c *gin.Context)  {
 		"VideoId": video.VideoId,
 		"ViewId" : viewId,
 		"EndTime": (time.Now().Unix() + conf.ViewExpireTime) * 1000,
+		"CameraOptional": video.CameraOptional,
+		"HeartbeatInterval": conf.ViewHeartbeatInterval * 1000,
 	})
 }
 
 func GetDataHandler(c *gin.Context) {
 	video := GetVideo(c)
-	var form Data
 
-	dr := &DataResult{0, 0, 0}
+	viewId, frame, err := ParseFrameRequest(c)
+	if err != nil {
+		SendDataResultJSON(c, http.StatusBadRequest, &DataResult{})
+		return
+	}
+
+	if !allowFrames(c, viewId, 1) {
+		return
+	}
+
+	code, dr := IngestFrame(video, viewId, frame)
+	if dr.RetryAfter > 0 {
+		c.Header("Retry-After", strconv.FormatInt(dr.RetryAfter, 10))
+	}
+	SendDataResultJSON(c, code, dr)
+}
+
+func BatchDataHandler(c *gin.Context) {
+	video := GetVideo(c)
+	var form BatchData
 
 	if c.BindJSON(&form) == nil {
-		viewTime := &db.ViewTime{
-			ViewId: form.ViewId,
-			Time: form.Time,
-			State: form.State,
-			Quality: form.Quality,
+		if len(form.Frames) > conf.BatchMaxFrames {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("a batch can have %d or less frames", conf.BatchMaxFrames),
+			})
+			return
 		}
 
-		viewTimeId, err := db.AddViewTime(video.VideoId, viewTime)
-		if err != nil {
-			SendDataResultJSON(c, http.StatusInternalServerError, dr)
+		if !allowFrames(c, form.ViewId, len(form.Frames)) {
 			return
 		}
 
-		if form.ImageNull {
-			dr.Status = 1
-			SendDataResultJSON(c, http.StatusOK, dr)
-			return
+		results := make([]gin.H, 0, len(form.Frames))
+		for _, batchFrame := range form.Frames {
+			code, dr := http.StatusBadRequest, &DataResult{}
+			frame, err := batchFrame.Frame()
+			if err == nil {
+				code, dr = IngestFrame(video, form.ViewId, frame)
+			}
+			result := DataResultJSON(dr)
+			result["code"] = code
+			results = append(results, result)
 		}
 
-		dr.Status = 2
+		c.JSON(http.StatusOK, gin.H{
+			"results": results,
+		})
+	} else {
+		c.JSON(http.StatusBadRequest, gin.H{})
+	}
+}
+
+// IngestFrame stores the view time of a single frame and queues its image for
+// analysis, returning the http status code and result for the frame
+func IngestFrame(video *db.Video, viewId string, frame *Frame) (int, *DataResult) {
+	return IngestFrameNotify(video, viewId, frame, nil)
+}
+
+// IngestFrameNotify is IngestFrame with a callback run with the final status
+// of the frame once it is analyzed
+func IngestFrameNotify(video *db.Video, viewId string, frame *Frame, done func(viewTimeStatus *db.ViewTimeStatus)) (int, *DataResult) {
+	dr := &DataResult{}
 
-		var viewStatsList []*db.ViewStats
+	if frame == nil {
+		return http.StatusBadRequest, dr
+	}
 
-		imageData, err := dataurl.DecodeString(form.ImageData)
+	viewTime := &db.ViewTime{
+		ViewId: viewId,
+		Seq: frame.Seq,
+		ClientTime: frame.ClientTime,
+		Time: frame.Time,
+		State: frame.State,
+		Quality: frame.Quality,
+		Status: db.ViewTimeStatusNoImage,
+	}
+
+	if frame.ImageNull {
+		viewTimeId, created, err := db.AddViewTime(video, viewTime)
 		if err != nil {
-			SendDataResultJSON(c, http.StatusBadRequest, dr)
-			return
+			return viewTimeErrorCode(err), dr
+		}
+		if !created {
+			return replayedFrame(viewTimeId)
 		}
 
-		requestUrl := "http://52.77.220.121:9999"
-		form := url.Values{}
+		dr.Status = db.ViewTimeStatusNoImage
+		dr.ViewTimeId = viewTimeId
+		dr.Flag = viewTime.Flag
+		return http.StatusOK, dr
+	}
 
-		form.Add("file", string(imageData.Data))
+	// while the analyzer is down the sample is kept but the frame isn't
+	// queued, the player is told to pause uploads
+	if unavailable, retryAfter := analyzer.Unavailable(); unavailable {
+		return unavailableFrame(video, viewTime, frame, retryAfter)
+	}
 
-		resp, err := http.Post(requestUrl, "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
+	if frame.Image == nil {
+		imageData, err := dataurl.DecodeString(frame.ImageData)
 		if err != nil {
-			SendDataResultJSON(c, http.StatusInternalServerError, dr)
-			return
+			return http.StatusBadRequest, dr
 		}
-		defer resp.Body.Close()
+		frame.Image = imageData.Data
+	}
+	if len(frame.Image) == 0 {
+		return http.StatusBadRequest, dr
+	}
 
-		respBody, err := ioutil.ReadAll(resp.Body)
+	viewTime.Status = db.ViewTimeStatusQueued
+
+	viewTimeId, created, err := db.AddViewTime(video, viewTime)
+	if err != nil {
+		return viewTimeErrorCode(err), dr
+	}
+	if !created {
+		// a frame that was never analyzed is queued again with the image it
+		// was sent with this time
+		requeued, err := db.RequeueViewTime(viewTimeId)
 		if err != nil {
-			SendDataResultJSON(c, http.StatusInternalServerError, dr)
-			return
+			return http.StatusInternalServerError, dr
+		}
+		if !requeued {
+			return replayedFrame(viewTimeId)
 		}
+		dr.Replayed = true
+	} else {
+		dr.Flag = viewTime.Flag
+	}
 
-		var errorJson map[string]interface{}
-		var respJson []map[string]interface{}
+	dr.ViewTimeId = viewTimeId
 
-		err = json.Unmarshal(respBody, &errorJson)
-		if err == nil {
-			dr.Status = 3
-			SendDataResultJSON(c, http.StatusOK, dr)
-			return
-		}
+	ingest.Archive(video, viewTimeId, frame.Image)
 
-		err = json.Unmarshal(respBody, &respJson)
-		if err != nil {
-			SendDataResultJSON(c, http.StatusInternalServerError, dr)
-			return
-		}
+	err = ingest.Submit(&ingest.Job{Video: video, ViewTimeId: viewTimeId, Image: frame.Image, Done: done})
+	if err != nil {
+		dr.Status = db.ViewTimeStatusDropped
+		db.UpdateViewTimeStatus(&db.ViewTimeStatus{ViewTimeId: viewTimeId, Status: db.ViewTimeStatusDropped})
+		return http.StatusServiceUnavailable, dr
+	}
 
-		for _, singlePerson := range respJson {
-			viewStats := &db.ViewStats{}
-			viewStats.ViewTimeId = viewTimeId
-
-			genderString := singlePerson["gender"].(string)
-			if genderString == "male" {
-				viewStats.Gender = -1;
-			} else if genderString == "female" {
-				viewStats.Gender = 1;
-			} else {
-				viewStats.Gender = 0;
-			}
+	dr.Status = db.ViewTimeStatusQueued
+	return http.StatusOK, dr
+}
 
-			viewStats.Age = int(singlePerson["age"].(float64))
-			viewStats.Mood = singlePerson["mood"].(float64)
+func unavailableFrame(video *db.Video, viewTime *db.ViewTime, frame *Frame, retryAfter time.Duration) (int, *DataResult) {
+	dr := &DataResult{}
 
-			headPose := singlePerson["headpose"].([]interface{})
+	viewTime.Status = db.ViewTimeStatusUnavailable
 
-			viewStats.HeadX = headPose[0].(float64)
-			viewStats.HeadY = headPose[1].(float64)
-			viewStats.HeadZ = headPose[2].(float64)
-			viewStats.HeadYaw = headPose[3].(float64)
-			viewStats.HeadPitch = headPose[4].(float64)
-			viewStats.HeadRoll = headPose[5].(float64)
+	viewTimeId, created, err := db.AddViewTime(video, viewTime)
+	if err != nil {
+		return viewTimeErrorCode(err), dr
+	}
+	if !created {
+		return replayedFrame(viewTimeId)
+	}
 
-			headGaze := singlePerson["headgaze"].([]interface{})
+	// archived frames can be analyzed later with -reanalyze
+	if frame.Image == nil {
+		imageData, err := dataurl.DecodeString(frame.ImageData)
+		if err == nil {
+			frame.Image = imageData.Data
+		}
+	}
+	if frame.Image != nil {
+		ingest.Archive(video, viewTimeId, frame.Image)
+	}
 
-			viewStats.HeadGazeX = headGaze[0].(float64)
-			viewStats.HeadGazeY = headGaze[1].(float64)
+	dr.Status = db.ViewTimeStatusUnavailable
+	dr.ViewTimeId = viewTimeId
+	dr.Flag = viewTime.Flag
+	dr.RetryAfter = int64(math.Ceil(retryAfter.Seconds()))
+	return http.StatusServiceUnavailable, dr
+}
 
-			emotions := singlePerson["emotions"].([]interface{})
+func viewTimeErrorCode(err error) int {
+	switch err.(type) {
+	case *db.UserError:
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
 
-			viewStats.Happy = emotions[0].(float64)
-			viewStats.Surprised = emotions[1].(float64)
-			viewStats.Angry = emotions[2].(float64)
-			viewStats.Disgusted = emotions[3].(float64)
-			viewStats.Afraid = emotions[4].(float64)
-			viewStats.Sad = emotions[5].(float64)
+// replayedFrame returns the current result of the original submission of a
+// frame sent again with the same sequence number
+func replayedFrame(viewTimeId int64) (int, *DataResult) {
+	viewTimeStatus, err := db.GetViewTimeStatusById(viewTimeId)
+	if err != nil {
+		return http.StatusInternalServerError, &DataResult{ViewTimeId: viewTimeId, Replayed: true}
+	}
 
-			viewStats.Engagement = Norm2(
-				viewStats.HeadYaw / 0.2,
-				viewStats.HeadPitch / 0.2,
-				viewStats.HeadGazeX / 300,
-				viewStats.HeadGazeY / 300,
-			)
+	dr := DataResultFromStatus(viewTimeStatus)
+	dr.Replayed = true
 
-			viewStatsList = append(viewStatsList, viewStats)
-		}
+	return http.StatusOK, dr
+}
 
-		dr.Status = 3
+func GetDataStatusHandler(c *gin.Context) {
+	video := GetVideo(c)
+	user := GetUser(c)
 
-		count := 0
-		for _, viewStats := range viewStatsList {
-			viewStats.ViewTimeId = viewTimeId
-			_, err = db.AddViewStats(viewStats)
-			if err == nil {
-				count += 1
-			}
+	dr := &DataResult{}
+
+	viewTimeId, err := strconv.ParseInt(c.Param("viewTimeId"), 10, 64)
+	if err != nil {
+		SendDataResultJSON(c, http.StatusBadRequest, dr)
+		return
+	}
+
+	viewTimeStatus, err := db.GetViewTimeStatus(user.Id, video.VideoId, viewTimeId)
+	if err != nil {
+		switch err.(type) {
+		case *db.UserError:
+			SendDataResultJSON(c, http.StatusNotFound, dr)
+			return
+		default:
+			SendDataResultJSON(c, http.StatusInternalServerError, dr)
+			return
 		}
+	}
 
-		dr.PeopleCount = len(viewStatsList)
-		dr.PeopleSuccessCount = count
+	SendDataResultJSON(c, http.StatusOK, DataResultFromStatus(viewTimeStatus))
+}
 
-		SendDataResultJSON(c, http.StatusOK, dr)
-	} else {
-		SendDataResultJSON(c, http.StatusBadRequest, dr)
+func DataResultFromStatus(viewTimeStatus *db.ViewTimeStatus) *DataResult {
+	dr := &DataResult{
+		Status: viewTimeStatus.Status,
+		ViewTimeId: viewTimeStatus.ViewTimeId,
+		PeopleCount: viewTimeStatus.PeopleCount,
+		PeopleSuccessCount: viewTimeStatus.PeopleSuccessCount,
+		Failures: ingest.DecodeFailures(viewTimeStatus.Failures),
 	}
+
+	if dr.Status == db.ViewTimeStatusUnavailable {
+		if unavailable, retryAfter := analyzer.Unavailable(); unavailable {
+			dr.RetryAfter = int64(math.Ceil(retryAfter.Seconds()))
+		}
+	}
+
+	return dr
 }
 
 func VideoMiddleware(c *gin.Context) {
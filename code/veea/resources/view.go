@@ -0,0 +1,110 @@
+package resources
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gpahal/veea/conf"
+	"github.com/gpahal/veea/db"
+)
+
+type ViewData struct {
+	ViewId string `json:"viewId" binding:"required"`
+}
+
+// ViewEndData ends a view, the events the player still had queued come with
+// it so they are stored before the view is finalized
+type ViewEndData struct {
+	ViewId string `json:"viewId" binding:"required"`
+	Reason string `json:"reason" binding:"required"`
+	Events []*Event `json:"events"`
+}
+
+func ViewStartHandler(c *gin.Context) {
+	video := GetVideo(c)
+	user := GetUser(c)
+	var form ViewData
+
+	if c.BindJSON(&form) == nil {
+		err := db.StartView(user.Id, video.VideoId, form.ViewId)
+		if err != nil {
+			sendViewError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{})
+	} else {
+		c.JSON(http.StatusBadRequest, gin.H{})
+	}
+}
+
+func ViewHeartbeatHandler(c *gin.Context) {
+	video := GetVideo(c)
+	user := GetUser(c)
+	var form ViewData
+
+	if c.BindJSON(&form) == nil {
+		err := db.HeartbeatView(user.Id, video.VideoId, form.ViewId)
+		if err != nil {
+			sendViewError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{})
+	} else {
+		c.JSON(http.StatusBadRequest, gin.H{})
+	}
+}
+
+// ViewEndHandler ends a view. Players send it with sendBeacon when the page is
+// left, as text/plain, so the body is read as JSON whatever its content type.
+func ViewEndHandler(c *gin.Context) {
+	video := GetVideo(c)
+	user := GetUser(c)
+	var form ViewEndData
+
+	if c.BindJSON(&form) == nil {
+		if len(form.Events) > conf.EventsMaxBatch {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("a request can have %d or less events", conf.EventsMaxBatch),
+			})
+			return
+		}
+
+		if len(form.Events) > 0 {
+			viewEvents, err := ViewEvents(form.Events)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{})
+				return
+			}
+
+			err = db.AddViewEvents(user.Id, video.VideoId, form.ViewId, viewEvents)
+			if err != nil {
+				sendViewError(c, err)
+				return
+			}
+		}
+
+		err := db.EndView(user.Id, video.VideoId, form.ViewId, form.Reason)
+		if err != nil {
+			sendViewError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{})
+	} else {
+		c.JSON(http.StatusBadRequest, gin.H{})
+	}
+}
+
+func sendViewError(c *gin.Context, err error) {
+	switch err.(type) {
+	case *db.UserError:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{})
+	}
+}
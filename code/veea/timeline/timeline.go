@@ -0,0 +1,308 @@
+package timeline
+
+import (
+	"sort"
+	"time"
+)
+
+// player states reported with every sample, as defined by the youtube player
+const (
+	statePlaying = 1
+	statePaused = 2
+)
+
+const (
+	// fastest playback rate the player offers
+	maxRate = 2.0
+	// slack (in seconds) for the jitter between the capture of a sample and
+	// the time it reaches the server
+	tolerance = 2.0
+	// wall clock time assumed between samples whose timestamps are equal
+	sampleInterval = 3.0
+	// ranges shorter than this (in seconds) are dropped
+	minLength = 0.01
+)
+
+type Range struct {
+	Start float64
+	End   float64
+}
+
+func (r Range) Length() float64 {
+	return r.End - r.Start
+}
+
+type Pause struct {
+	At       float64
+	Duration float64
+}
+
+// Timeline is the playback of a single view. Watched is every part of the
+// video that was played at least once, Rewatched the parts played more than
+// once, Skipped the parts jumped over by seeking ahead and never played.
+type Timeline struct {
+	Watched   []Range
+	Rewatched []Range
+	Skipped   []Range
+	Pauses    []Pause
+
+	// every range that was played, before merging
+	plays []Range
+}
+
+// WatchTime is the time (in seconds of video) the player was playing, parts
+// played more than once count every time. Pauses, buffering and skipped parts
+// are left out.
+func (t *Timeline) WatchTime() float64 {
+	var watchTime float64
+	for _, r := range t.plays {
+		watchTime += r.Length()
+	}
+
+	return watchTime
+}
+
+// Sample is the position of the player of a view at the time a frame was
+// captured
+type Sample struct {
+	Time  float64
+	State int
+	At    time.Time
+}
+
+// Event is a player event of a view, From and To are only used by seeks
+type Event struct {
+	Type      string
+	VideoTime float64
+	From      float64
+	To        float64
+	At        time.Time
+}
+
+type builder struct {
+	plays  []Range
+	jumps  []Range
+	pauses []Pause
+}
+
+func (b *builder) play(start float64, end float64) {
+	if end - start >= minLength {
+		b.plays = append(b.plays, Range{Start: start, End: end})
+	}
+}
+
+func (b *builder) jump(from float64, to float64) {
+	if to - from >= minLength {
+		b.jumps = append(b.jumps, Range{Start: from, End: to})
+	}
+}
+
+func (b *builder) pause(at float64, duration float64) {
+	if duration > 0 {
+		b.pauses = append(b.pauses, Pause{At: at, Duration: duration})
+	}
+}
+
+// FromSamples rebuilds a timeline from the samples of a view ordered by
+// capture. Samples only show where the player was every few seconds, so a
+// forward jump between two samples is counted as skipped as a whole.
+func FromSamples(samples []*Sample) *Timeline {
+	b := &builder{}
+
+	pausing := false
+	for i := 1; i < len(samples); i += 1 {
+		prev := samples[i - 1]
+		cur := samples[i]
+
+		wall := cur.At.Sub(prev.At).Seconds()
+		if wall <= 0 {
+			wall = sampleInterval
+		}
+		delta := cur.Time - prev.Time
+
+		continuous := false
+		switch prev.State {
+		case statePlaying:
+			continuous = delta >= 0 && delta <= wall * maxRate + tolerance
+			if continuous {
+				b.play(prev.Time, cur.Time)
+			}
+		case statePaused:
+			continuous = delta >= -tolerance && delta <= tolerance
+			if continuous {
+				if pausing && len(b.pauses) > 0 {
+					b.pauses[len(b.pauses) - 1].Duration += wall
+				} else {
+					b.pause(prev.Time, wall)
+				}
+			}
+		default:
+			continuous = delta >= -tolerance && delta <= wall * maxRate + tolerance
+		}
+
+		if !continuous && delta > 0 {
+			b.jump(prev.Time, cur.Time)
+		}
+
+		pausing = continuous && prev.State == statePaused && cur.State == statePaused
+	}
+
+	return b.finish()
+}
+
+// FromEvents rebuilds a timeline from the player events of a view ordered by
+// client time. A play still running after the last event is closed at the
+// last sample if there is one after it.
+func FromEvents(events []*Event, last *Sample) *Timeline {
+	b := &builder{}
+
+	playing := false
+	var playStart float64
+	paused := false
+	var pauseAt float64
+	var pauseStart time.Time
+	var lastAt time.Time
+
+	stopPlay := func(at float64) {
+		if playing {
+			b.play(playStart, at)
+			playing = false
+		}
+	}
+	stopPause := func(at time.Time) {
+		if paused {
+			b.pause(pauseAt, at.Sub(pauseStart).Seconds())
+			paused = false
+		}
+	}
+
+	for _, event := range events {
+		lastAt = event.At
+
+		switch event.Type {
+		case "play":
+			stopPause(event.At)
+			stopPlay(event.VideoTime)
+			playing = true
+			playStart = event.VideoTime
+		case "pause":
+			stopPlay(event.VideoTime)
+			stopPause(event.At)
+			paused = true
+			pauseAt = event.VideoTime
+			pauseStart = event.At
+		case "buffering":
+			stopPlay(event.VideoTime)
+		case "end":
+			stopPlay(event.VideoTime)
+			stopPause(event.At)
+		case "seek":
+			if playing {
+				b.play(playStart, event.From)
+				playStart = event.To
+			}
+			if event.To > event.From {
+				b.jump(event.From, event.To)
+			}
+		}
+	}
+
+	if last != nil && last.At.After(lastAt) {
+		stopPlay(last.Time)
+		stopPause(last.At)
+	}
+
+	return b.finish()
+}
+
+func (b *builder) finish() *Timeline {
+	t := &Timeline{Pauses: b.pauses, plays: b.plays}
+
+	covered := []Range{}
+	rewatched := []Range{}
+	for _, play := range b.plays {
+		rewatched = append(rewatched, intersect(covered, play)...)
+		covered = merge(append(covered, play))
+	}
+
+	t.Watched = covered
+	t.Rewatched = merge(rewatched)
+	t.Skipped = subtract(merge(b.jumps), covered)
+
+	return t
+}
+
+// merge sorts ranges and joins the overlapping ones
+func merge(ranges []Range) []Range {
+	if len(ranges) == 0 {
+		return []Range{}
+	}
+
+	sorted := make([]Range, len(ranges))
+	copy(sorted, ranges)
+	sort.Sort(byStart(sorted))
+
+	merged := []Range{sorted[0]}
+	for _, r := range sorted[1:] {
+		lastRange := &merged[len(merged) - 1]
+		if r.Start <= lastRange.End {
+			if r.End > lastRange.End {
+				lastRange.End = r.End
+			}
+		} else {
+			merged = append(merged, r)
+		}
+	}
+
+	return merged
+}
+
+// intersect returns the parts of r inside the merged ranges
+func intersect(merged []Range, r Range) []Range {
+	parts := []Range{}
+	for _, m := range merged {
+		start, end := m.Start, m.End
+		if r.Start > start {
+			start = r.Start
+		}
+		if r.End < end {
+			end = r.End
+		}
+		if end - start >= minLength {
+			parts = append(parts, Range{Start: start, End: end})
+		}
+	}
+
+	return parts
+}
+
+// subtract returns the parts of the merged ranges outside of the merged
+// ranges to remove
+func subtract(merged []Range, remove []Range) []Range {
+	parts := []Range{}
+	for _, r := range merged {
+		start := r.Start
+		for _, m := range remove {
+			if m.End <= start || m.Start >= r.End {
+				continue
+			}
+			if m.Start - start >= minLength {
+				parts = append(parts, Range{Start: start, End: m.Start})
+			}
+			if m.End > start {
+				start = m.End
+			}
+		}
+		if r.End - start >= minLength {
+			parts = append(parts, Range{Start: start, End: r.End})
+		}
+	}
+
+	return parts
+}
+
+type byStart []Range
+
+func (rs byStart) Len() int           { return len(rs) }
+func (rs byStart) Less(i, j int) bool { return rs[i].Start < rs[j].Start }
+func (rs byStart) Swap(i, j int)      { rs[i], rs[j] = rs[j], rs[i] }
@@ -0,0 +1,178 @@
+package timeline
+
+import (
+	"math"
+	"time"
+	"testing"
+)
+
+var start = time.Date(2016, 4, 1, 12, 0, 0, 0, time.UTC)
+
+func at(seconds float64) time.Time {
+	return start.Add(time.Duration(seconds * float64(time.Second)))
+}
+
+func playing(videoTime float64, wall float64) *Sample {
+	return &Sample{Time: videoTime, State: statePlaying, At: at(wall)}
+}
+
+func paused(videoTime float64, wall float64) *Sample {
+	return &Sample{Time: videoTime, State: statePaused, At: at(wall)}
+}
+
+func equalRanges(a []Range, b []Range) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if math.Abs(a[i].Start - b[i].Start) > 1e-9 || math.Abs(a[i].End - b[i].End) > 1e-9 {
+			return false
+		}
+	}
+
+	return true
+}
+
+func equalPauses(a []Pause, b []Pause) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if math.Abs(a[i].At - b[i].At) > 1e-9 || math.Abs(a[i].Duration - b[i].Duration) > 1e-9 {
+			return false
+		}
+	}
+
+	return true
+}
+
+type timelineTest struct {
+	name      string
+	watched   []Range
+	rewatched []Range
+	skipped   []Range
+	pauses    []Pause
+	watchTime float64
+}
+
+func (test *timelineTest) check(t *testing.T, timeline *Timeline) {
+	if !equalRanges(timeline.Watched, test.watched) {
+		t.Errorf("%s: watched = %v, want %v", test.name, timeline.Watched, test.watched)
+	}
+	if !equalRanges(timeline.Rewatched, test.rewatched) {
+		t.Errorf("%s: rewatched = %v, want %v", test.name, timeline.Rewatched, test.rewatched)
+	}
+	if !equalRanges(timeline.Skipped, test.skipped) {
+		t.Errorf("%s: skipped = %v, want %v", test.name, timeline.Skipped, test.skipped)
+	}
+	if !equalPauses(timeline.Pauses, test.pauses) {
+		t.Errorf("%s: pauses = %v, want %v", test.name, timeline.Pauses, test.pauses)
+	}
+	if math.Abs(timeline.WatchTime() - test.watchTime) > 1e-9 {
+		t.Errorf("%s: watch time = %v, want %v", test.name, timeline.WatchTime(), test.watchTime)
+	}
+}
+
+func TestFromSamples(t *testing.T) {
+	tests := []struct {
+		timelineTest
+		samples []*Sample
+	}{
+		{
+			timelineTest{name: "continuous", watched: []Range{{0, 9}}, rewatched: []Range{}, skipped: []Range{}, watchTime: 9},
+			[]*Sample{playing(0, 0), playing(3, 3), playing(6, 6), playing(9, 9)},
+		},
+		{
+			timelineTest{name: "forward jump", watched: []Range{{0, 3}, {40, 43}}, rewatched: []Range{}, skipped: []Range{{3, 40}}, watchTime: 6},
+			[]*Sample{playing(0, 0), playing(3, 3), playing(40, 6), playing(43, 9)},
+		},
+		{
+			timelineTest{name: "pause", watched: []Range{{0, 10}}, rewatched: []Range{}, skipped: []Range{}, pauses: []Pause{{10, 6}}, watchTime: 10},
+			[]*Sample{playing(0, 0), paused(10, 10), paused(10, 13), paused(10, 16)},
+		},
+		{
+			timelineTest{name: "rewatch", watched: []Range{{0, 6}}, rewatched: []Range{{0, 6}}, skipped: []Range{}, watchTime: 12},
+			[]*Sample{playing(0, 0), playing(3, 3), playing(6, 6), playing(0, 9), playing(3, 12), playing(6, 15)},
+		},
+		{
+			timelineTest{name: "equal timestamps", watched: []Range{{0, 6}}, rewatched: []Range{}, skipped: []Range{}, watchTime: 6},
+			[]*Sample{playing(0, 0), playing(3, 0), playing(6, 0)},
+		},
+	}
+
+	for _, test := range tests {
+		test.check(t, FromSamples(test.samples))
+	}
+}
+
+func event(eventType string, videoTime float64, wall float64) *Event {
+	return &Event{Type: eventType, VideoTime: videoTime, At: at(wall)}
+}
+
+func seek(from float64, to float64, wall float64) *Event {
+	return &Event{Type: "seek", VideoTime: to, From: from, To: to, At: at(wall)}
+}
+
+func TestFromEvents(t *testing.T) {
+	tests := []struct {
+		timelineTest
+		events []*Event
+		last   *Sample
+	}{
+		{
+			timelineTest{name: "play pause play end", watched: []Range{{0, 20}}, rewatched: []Range{}, skipped: []Range{}, pauses: []Pause{{10, 5}}, watchTime: 20},
+			[]*Event{event("play", 0, 0), event("pause", 10, 10), event("play", 10, 15), event("end", 20, 25)},
+			nil,
+		},
+		{
+			timelineTest{name: "forward seek", watched: []Range{{0, 5}, {30, 35}}, rewatched: []Range{}, skipped: []Range{{5, 30}}, watchTime: 10},
+			[]*Event{event("play", 0, 0), seek(5, 30, 5), event("pause", 35, 10)},
+			nil,
+		},
+		{
+			timelineTest{name: "closed by the last sample", watched: []Range{{0, 12}}, rewatched: []Range{}, skipped: []Range{}, watchTime: 12},
+			[]*Event{event("play", 0, 0)},
+			playing(12, 12),
+		},
+		{
+			timelineTest{name: "last sample before the last event", watched: []Range{{0, 8}}, rewatched: []Range{}, skipped: []Range{}, watchTime: 8},
+			[]*Event{event("play", 0, 0), event("pause", 8, 8)},
+			paused(6, 6),
+		},
+		{
+			timelineTest{name: "played three times", watched: []Range{{0, 10}}, rewatched: []Range{{0, 10}}, skipped: []Range{}, watchTime: 30},
+			[]*Event{event("play", 0, 0), seek(10, 0, 10), seek(10, 0, 20), event("pause", 10, 30)},
+			nil,
+		},
+	}
+
+	for _, test := range tests {
+		test.check(t, FromEvents(test.events, test.last))
+	}
+}
+
+func TestWatchTime(t *testing.T) {
+	tests := []struct {
+		name      string
+		plays     []Range
+		watchTime float64
+	}{
+		{"nothing played", nil, 0},
+		{"once", []Range{{0, 10}}, 10},
+		{"disjoint", []Range{{0, 10}, {20, 25}}, 15},
+		{"overlapping", []Range{{0, 10}, {5, 15}}, 20},
+		{"four times", []Range{{0, 4}, {0, 4}, {0, 4}, {0, 4}}, 16},
+	}
+
+	for _, test := range tests {
+		b := &builder{}
+		for _, play := range test.plays {
+			b.play(play.Start, play.End)
+		}
+
+		watchTime := b.finish().WatchTime()
+		if math.Abs(watchTime - test.watchTime) > 1e-9 {
+			t.Errorf("%s: watch time = %v, want %v", test.name, watchTime, test.watchTime)
+		}
+	}
+}
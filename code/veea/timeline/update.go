@@ -0,0 +1,179 @@
+package timeline
+
+import (
+	"time"
+
+	"github.com/gpahal/veea/db"
+	log "github.com/Sirupsen/logrus"
+)
+
+// Build rebuilds the timeline of a view from its player events, or from its
+// samples for players that sent no events
+func Build(viewId string) (*Timeline, error) {
+	viewEvents, err := db.GetViewEvents(viewId)
+	if err != nil {
+		return nil, err
+	}
+
+	viewSamples, err := db.GetViewSamples(viewId)
+	if err != nil {
+		return nil, err
+	}
+
+	// events and the capture times of samples are timed by the client clock,
+	// they are moved onto the server clock that samples of players without
+	// capture times are received by
+	offset := ClockOffset(viewEvents)
+
+	samples := make([]*Sample, 0, len(viewSamples))
+	for _, viewSample := range viewSamples {
+		at := viewSample.CreatedAt
+		if viewSample.ClientTime > 0 {
+			at = clientTime(viewSample.ClientTime).Add(offset)
+		}
+		samples = append(samples, &Sample{Time: viewSample.Time, State: viewSample.State, At: at})
+	}
+
+	if len(viewEvents) == 0 {
+		return FromSamples(samples), nil
+	}
+
+	events := make([]*Event, 0, len(viewEvents))
+	for _, viewEvent := range viewEvents {
+		events = append(events, &Event{
+			Type: viewEvent.Type,
+			VideoTime: viewEvent.VideoTime,
+			From: viewEvent.From,
+			To: viewEvent.To,
+			At: clientTime(viewEvent.ClientTime).Add(offset),
+		})
+	}
+
+	var last *Sample
+	if len(samples) > 0 {
+		last = samples[len(samples) - 1]
+	}
+
+	return FromEvents(events, last), nil
+}
+
+// ClockOffset is the time the server clock is ahead of the client clock of a
+// view. Events reach the server at most a few seconds after they happen, the
+// smallest gap between the time an event was received and its client time is
+// taken as the offset (it is off by the shortest upload delay).
+func ClockOffset(viewEvents []*db.ViewEvent) time.Duration {
+	var offset time.Duration
+	for idx, viewEvent := range viewEvents {
+		gap := viewEvent.CreatedAt.Sub(clientTime(viewEvent.ClientTime))
+		if idx == 0 || gap < offset {
+			offset = gap
+		}
+	}
+
+	return offset
+}
+
+// clientTime converts a client time in milliseconds since the epoch
+func clientTime(ms int64) time.Time {
+	return time.Unix(0, ms * int64(time.Millisecond))
+}
+
+// Update rebuilds and stores the timelines of the views that changed since
+// their timeline was last built. A view that fails is logged and tried again
+// with the next update.
+func Update() error {
+	viewIds, err := db.GetStaleTimelineViewIds()
+	if err != nil {
+		return err
+	}
+
+	for _, viewId := range viewIds {
+		builtAt := time.Now()
+
+		t, err := Build(viewId)
+		if err == nil {
+			// a view finalized since its id was read keeps its final timeline
+			_, err = db.ReplaceViewSegments(viewId, Segments(t), t.WatchTime(), builtAt)
+		}
+		if err != nil {
+			log.WithFields(log.Fields{
+				"viewId": viewId,
+				"error": err.Error(),
+			}).Error("Error updating view timeline")
+		}
+	}
+
+	return nil
+}
+
+// Finalize builds the last timeline of the views that are due and closes
+// them. It goes on in batches until none are left, so the views that expired
+// while no instance was running are caught up at once.
+func Finalize() error {
+	for {
+		viewIds, err := db.GetDueViewIds()
+		if err != nil {
+			return err
+		}
+
+		if len(viewIds) == 0 {
+			return nil
+		}
+
+		finalized, failed := 0, 0
+		for _, viewId := range viewIds {
+			builtAt := time.Now()
+
+			var ok bool
+			t, err := Build(viewId)
+			if err == nil {
+				ok, err = db.FinalizeView(viewId, Segments(t), t.WatchTime(), builtAt)
+			}
+			if err != nil {
+				// the view is closed with its error, it would be due again
+				// right away otherwise
+				log.WithFields(log.Fields{
+					"viewId": viewId,
+					"error": err.Error(),
+				}).Error("Error finalizing view")
+
+				ok, err = db.FailViewFinalization(viewId, err)
+				if err != nil {
+					return err
+				}
+				if ok {
+					failed += 1
+				}
+				continue
+			}
+			if ok {
+				finalized += 1
+			}
+		}
+
+		log.WithFields(log.Fields{
+			"views": finalized,
+			"failed": failed,
+		}).Info("Finalized views")
+	}
+}
+
+func Segments(t *Timeline) []*db.ViewSegment {
+	segments := []*db.ViewSegment{}
+
+	addRanges := func(kind string, ranges []Range) {
+		for _, r := range ranges {
+			segments = append(segments, &db.ViewSegment{Kind: kind, Start: r.Start, End: r.End, Duration: r.Length()})
+		}
+	}
+
+	addRanges(db.ViewSegmentWatched, t.Watched)
+	addRanges(db.ViewSegmentRewatched, t.Rewatched)
+	addRanges(db.ViewSegmentSkipped, t.Skipped)
+
+	for _, pause := range t.Pauses {
+		segments = append(segments, &db.ViewSegment{Kind: db.ViewSegmentPause, Start: pause.At, End: pause.At, Duration: pause.Duration})
+	}
+
+	return segments
+}
@@ -0,0 +1,80 @@
+package db
+
+import (
+	"time"
+	"errors"
+)
+
+// consent texts are published here and accepted by participants in veea, a
+// published text is never edited so every acceptance refers to the exact
+// text that was shown
+type ConsentText struct {
+	Version     int64
+	Body        string
+	CreatedBy   string
+	CreatedAt   time.Time
+	Acceptances int64
+}
+
+func GetConsentTexts(userId int64) ([]*ConsentText, error) {
+	err := errorFold(
+		UserIdAdminExists(userId),
+	)
+	if err != nil {
+		return nil, &UserError{error: err}
+	}
+
+	rows, err := query("SELECT T.version, T.body, IFNULL(U.username, ''), T.created_at, (SELECT COUNT(*) FROM consent AS C WHERE C.version = T.version) FROM consent_text AS T LEFT JOIN user AS U ON T.created_by = U.id ORDER BY T.version DESC")
+	if err != nil {
+		return nil, &InternalError{error: err}
+	}
+	defer rows.Close()
+
+	consentTexts := []*ConsentText{}
+
+	for rows.Next() {
+		var consentText ConsentText
+		err = rows.Scan(
+			&consentText.Version,
+			&consentText.Body,
+			&consentText.CreatedBy,
+			&consentText.CreatedAt,
+			&consentText.Acceptances,
+		)
+
+		if err != nil {
+			return nil, &InternalError{error: err}
+		}
+
+		consentTexts = append(consentTexts, &consentText)
+	}
+
+	return consentTexts, nil
+}
+
+// AddConsentText publishes a new version of the consent text, participants
+// have to accept it before their next view
+func AddConsentText(userId int64, body string) error {
+	err := errorFold(
+		UserIdAdminExists(userId),
+		validateConsentText(body),
+	)
+	if err != nil {
+		return &UserError{error: err}
+	}
+
+	res, err := exec("INSERT INTO consent_text (body, created_by) VALUES (?, ?)", body, userId)
+	if err != nil {
+		return &InternalError{error: err}
+	}
+
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return &InternalError{error: err}
+	}
+	if ra < 1 {
+		return &InternalError{error: errors.New("Add consent text failed")}
+	}
+
+	return nil
+}
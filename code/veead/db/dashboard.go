@@ -2,7 +2,10 @@ package db
 
 import (
 	"errors"
+	"strconv"
 	"database/sql"
+
+	"github.com/gpahal/veea/privacy"
 )
 
 func GetTotalViews(videoId string) (int64, error) {
@@ -55,8 +58,12 @@ func GetUniqueVisitors(videoId string) (int64, error) {
 	return 0, errors.New("COUNT(*) returned 0 rows")
 }
 
-func GetAverageViewDuration(videoId string, videoDuration float64) (float64, bool, error) {
-	rows, err := query("SELECT AVG(view_duration) FROM video_view WHERE video_id = ? AND view_duration >= 0 AND view_duration <= ?", videoId, videoDuration)
+// GetAverageViewDuration returns the average watch time of the views of a
+// video, it is stored with the playback timeline of every view and counts
+// rewatched parts, so it can exceed the duration of the video
+func GetAverageViewDuration(videoId string) (float64, bool, error) {
+	// open views have only part of their watch time yet
+	rows, err := query("SELECT AVG(view_duration) FROM video_view WHERE video_id = ? AND view_duration >= 0 AND finalized_at IS NOT NULL", videoId)
 	if err != nil {
 		return 0, false, &InternalError{error: err}
 	}
@@ -81,7 +88,7 @@ func GetAverageViewDuration(videoId string, videoDuration float64) (float64, boo
 }
 
 func GetMaleCount(videoId string) (int64, error) {
-	rows, err := query("SELECT COUNT(*) FROM video_view_stats WHERE view_time_id IN (SELECT B.id FROM video_view AS A, video_view_time AS B WHERE A.video_id = ? AND A.view_id = B.view_id) AND gender < 0", videoId)
+	rows, err := query("SELECT COUNT(*) FROM video_view_stats WHERE view_time_id IN (SELECT B.id FROM video_view AS A, video_view_time AS B WHERE A.video_id = ? AND A.view_id = B.view_id AND B.flag IS NULL) AND gender < 0", videoId)
 	if err != nil {
 		return 0, &InternalError{error: err}
 	}
@@ -106,7 +113,7 @@ func GetMaleCount(videoId string) (int64, error) {
 }
 
 func GetFemaleCount(videoId string) (int64, error) {
-	rows, err := query("SELECT COUNT(*) FROM video_view_stats WHERE view_time_id IN (SELECT B.id FROM video_view AS A, video_view_time AS B WHERE A.video_id = ? AND A.view_id = B.view_id) AND gender > 0", videoId)
+	rows, err := query("SELECT COUNT(*) FROM video_view_stats WHERE view_time_id IN (SELECT B.id FROM video_view AS A, video_view_time AS B WHERE A.video_id = ? AND A.view_id = B.view_id AND B.flag IS NULL) AND gender > 0", videoId)
 	if err != nil {
 		return 0, &InternalError{error: err}
 	}
@@ -131,36 +138,31 @@ func GetFemaleCount(videoId string) (int64, error) {
 }
 
 func GetAgeCounts(videoId string) ([]int64, error) {
-	rows, err := query("SELECT age, COUNT(*) FROM video_view_stats WHERE view_time_id IN (SELECT B.id FROM video_view AS A, video_view_time AS B WHERE A.video_id = ? AND A.view_id = B.view_id) GROUP BY age", videoId)
+	rows, err := query("SELECT age_bucket, COUNT(*) FROM video_view_stats WHERE view_time_id IN (SELECT B.id FROM video_view AS A, video_view_time AS B WHERE A.video_id = ? AND A.view_id = B.view_id AND B.flag IS NULL) AND age_bucket IS NOT NULL GROUP BY age_bucket", videoId)
 	if err != nil {
 		return nil, &InternalError{error: err}
 	}
 	defer rows.Close()
 
-	// age ranges: <18, 28-30, 31-50, >50
-	ageCounts := make([]int64, 4, 4)
+	return scanAgeCounts(rows)
+}
+
+// scanAgeCounts reads the number of faces per age range, ages are only stored
+// as a range (privacy.AgeBucket) when the privacy mode of the video is bucketed
+func scanAgeCounts(rows *sql.Rows) ([]int64, error) {
+	ageCounts := make([]int64, privacy.AgeBucketCount, privacy.AgeBucketCount)
 
 	for rows.Next() {
-		var age int
+		var bucket int
 		var count sql.NullInt64
-		err = rows.Scan(&age, &count)
+		err := rows.Scan(&bucket, &count)
 
 		if err != nil {
 			return nil, &InternalError{error: err}
 		}
 
-		if count.Valid {
-			if age < 0 {
-				continue
-			} else if age < 18 {
-				ageCounts[0] += 1
-			} else if age < 31 {
-				ageCounts[1] += 1
-			} else if age < 51 {
-				ageCounts[2] += 1
-			} else {
-				ageCounts[3] += 1
-			}
+		if count.Valid && bucket >= 0 && bucket < privacy.AgeBucketCount {
+			ageCounts[bucket] += count.Int64
 		}
 	}
 
@@ -189,7 +191,7 @@ func GetMaxEngagement() (float64, error) {
 }
 
 func GetStats(videoId string) ([]float64, error) {
-	rows, err := query("SELECT AVG(mood), AVG(happy), AVG(surprised), AVG(angry), AVG(disgusted), AVG(afraid), AVG(sad), AVG(engagement) FROM video_view_stats WHERE view_time_id IN (SELECT B.id FROM video_view AS A, video_view_time AS B WHERE A.video_id = ? AND A.view_id = B.view_id)", videoId)
+	rows, err := query("SELECT AVG(mood), AVG(happy), AVG(surprised), AVG(angry), AVG(disgusted), AVG(afraid), AVG(sad), AVG(engagement) FROM video_view_stats WHERE view_time_id IN (SELECT B.id FROM video_view AS A, video_view_time AS B WHERE A.video_id = ? AND A.view_id = B.view_id AND B.flag IS NULL)", videoId)
 	if err != nil {
 		return nil, &InternalError{error: err}
 	}
@@ -233,7 +235,7 @@ func GetStats(videoId string) ([]float64, error) {
 }
 
 func GetInstantStats(videoId string, startTime float64, endTime float64) ([]float64, error) {
-	rows, err := query("SELECT AVG(mood), AVG(happy), AVG(surprised), AVG(angry), AVG(disgusted), AVG(afraid), AVG(sad), AVG(engagement) FROM video_view_stats WHERE view_time_id IN (SELECT B.id FROM video_view AS A, video_view_time AS B WHERE A.video_id = ? AND A.view_id = B.view_id AND B.time >= ? AND B.time < ?)", videoId, startTime, endTime)
+	rows, err := query("SELECT AVG(mood), AVG(happy), AVG(surprised), AVG(angry), AVG(disgusted), AVG(afraid), AVG(sad), AVG(engagement) FROM video_view_stats WHERE view_time_id IN (SELECT B.id FROM video_view AS A, video_view_time AS B WHERE A.video_id = ? AND A.view_id = B.view_id AND B.flag IS NULL AND B.time >= ? AND B.time < ?)", videoId, startTime, endTime)
 	if err != nil {
 		return nil, &InternalError{error: err}
 	}
@@ -277,7 +279,7 @@ func GetInstantStats(videoId string, startTime float64, endTime float64) ([]floa
 }
 
 func GetInstantViewedCount(videoId string, startTime float64, endTime float64) (int64, error) {
-	rows, err := query("SELECT COUNT(DISTINCT B.id) FROM video_view AS A, video_view_time AS B WHERE A.video_id = ? AND A.view_id = B.view_id AND B.time >= ? AND B.time < ?", videoId, startTime, endTime)
+	rows, err := query("SELECT COUNT(DISTINCT B.id) FROM video_view AS A, video_view_time AS B WHERE A.video_id = ? AND A.view_id = B.view_id AND B.flag IS NULL AND B.time >= ? AND B.time < ?", videoId, startTime, endTime)
 	if err != nil {
 		return 0, &InternalError{error: err}
 	}
@@ -301,8 +303,8 @@ func GetInstantViewedCount(videoId string, startTime float64, endTime float64) (
 	return 0, errors.New("COUNT(*) returned 0 rows")
 }
 
-func GetAverageViewDurationSingle(viewId string, videoDuration float64) (float64, bool, error) {
-	rows, err := query("SELECT AVG(view_duration) FROM video_view WHERE view_id = ? AND view_duration >= 0 AND view_duration <= ?", viewId, videoDuration)
+func GetAverageViewDurationSingle(viewId string) (float64, bool, error) {
+	rows, err := query("SELECT AVG(view_duration) FROM video_view WHERE view_id = ? AND view_duration >= 0 AND finalized_at IS NOT NULL", viewId)
 	if err != nil {
 		return 0, false, &InternalError{error: err}
 	}
@@ -327,7 +329,7 @@ func GetAverageViewDurationSingle(viewId string, videoDuration float64) (float64
 }
 
 func GetMaleCountSingle(viewId string) (int64, error) {
-	rows, err := query("SELECT COUNT(*) FROM video_view_stats WHERE view_time_id IN (SELECT B.id FROM video_view AS A, video_view_time AS B WHERE A.view_id = ? AND A.view_id = B.view_id) AND gender < 0", viewId)
+	rows, err := query("SELECT COUNT(*) FROM video_view_stats WHERE view_time_id IN (SELECT B.id FROM video_view AS A, video_view_time AS B WHERE A.view_id = ? AND A.view_id = B.view_id AND B.flag IS NULL) AND gender < 0", viewId)
 	if err != nil {
 		return 0, &InternalError{error: err}
 	}
@@ -352,7 +354,7 @@ func GetMaleCountSingle(viewId string) (int64, error) {
 }
 
 func GetFemaleCountSingle(viewId string) (int64, error) {
-	rows, err := query("SELECT COUNT(*) FROM video_view_stats WHERE view_time_id IN (SELECT B.id FROM video_view AS A, video_view_time AS B WHERE A.view_id = ? AND A.view_id = B.view_id) AND gender > 0", viewId)
+	rows, err := query("SELECT COUNT(*) FROM video_view_stats WHERE view_time_id IN (SELECT B.id FROM video_view AS A, video_view_time AS B WHERE A.view_id = ? AND A.view_id = B.view_id AND B.flag IS NULL) AND gender > 0", viewId)
 	if err != nil {
 		return 0, &InternalError{error: err}
 	}
@@ -377,44 +379,17 @@ func GetFemaleCountSingle(viewId string) (int64, error) {
 }
 
 func GetAgeCountsSingle(viewId string) ([]int64, error) {
-	rows, err := query("SELECT age, COUNT(*) FROM video_view_stats WHERE view_time_id IN (SELECT B.id FROM video_view AS A, video_view_time AS B WHERE A.view_id = ? AND A.view_id = B.view_id) GROUP BY age", viewId)
+	rows, err := query("SELECT age_bucket, COUNT(*) FROM video_view_stats WHERE view_time_id IN (SELECT B.id FROM video_view AS A, video_view_time AS B WHERE A.view_id = ? AND A.view_id = B.view_id AND B.flag IS NULL) AND age_bucket IS NOT NULL GROUP BY age_bucket", viewId)
 	if err != nil {
 		return nil, &InternalError{error: err}
 	}
 	defer rows.Close()
 
-	// age ranges: <18, 28-30, 31-50, >50
-	ageCounts := make([]int64, 4, 4)
-
-	for rows.Next() {
-		var age int
-		var count sql.NullInt64
-		err = rows.Scan(&age, &count)
-
-		if err != nil {
-			return nil, &InternalError{error: err}
-		}
-
-		if count.Valid {
-			if age < 0 {
-				continue
-			} else if age < 18 {
-				ageCounts[0] += 1
-			} else if age < 31 {
-				ageCounts[1] += 1
-			} else if age < 51 {
-				ageCounts[2] += 1
-			} else {
-				ageCounts[3] += 1
-			}
-		}
-	}
-
-	return ageCounts, nil
+	return scanAgeCounts(rows)
 }
 
 func GetStatsSingle(viewId string) ([]float64, error) {
-	rows, err := query("SELECT AVG(mood), AVG(happy), AVG(surprised), AVG(angry), AVG(disgusted), AVG(afraid), AVG(sad), AVG(engagement) FROM video_view_stats WHERE view_time_id IN (SELECT B.id FROM video_view AS A, video_view_time AS B WHERE A.view_id = ? AND A.view_id = B.view_id)", viewId)
+	rows, err := query("SELECT AVG(mood), AVG(happy), AVG(surprised), AVG(angry), AVG(disgusted), AVG(afraid), AVG(sad), AVG(engagement) FROM video_view_stats WHERE view_time_id IN (SELECT B.id FROM video_view AS A, video_view_time AS B WHERE A.view_id = ? AND A.view_id = B.view_id AND B.flag IS NULL)", viewId)
 	if err != nil {
 		return nil, &InternalError{error: err}
 	}
@@ -458,7 +433,7 @@ func GetStatsSingle(viewId string) ([]float64, error) {
 }
 
 func GetInstantStatsSingle(viewId string, startTime float64, endTime float64) ([]float64, error) {
-	rows, err := query("SELECT AVG(mood), AVG(happy), AVG(surprised), AVG(angry), AVG(disgusted), AVG(afraid), AVG(sad), AVG(engagement) FROM video_view_stats WHERE view_time_id IN (SELECT B.id FROM video_view AS A, video_view_time AS B WHERE A.view_id = ? AND A.view_id = B.view_id AND B.time >= ? AND B.time < ?)", viewId, startTime, endTime)
+	rows, err := query("SELECT AVG(mood), AVG(happy), AVG(surprised), AVG(angry), AVG(disgusted), AVG(afraid), AVG(sad), AVG(engagement) FROM video_view_stats WHERE view_time_id IN (SELECT B.id FROM video_view AS A, video_view_time AS B WHERE A.view_id = ? AND A.view_id = B.view_id AND B.flag IS NULL AND B.time >= ? AND B.time < ?)", viewId, startTime, endTime)
 	if err != nil {
 		return nil, &InternalError{error: err}
 	}
@@ -502,7 +477,7 @@ func GetInstantStatsSingle(viewId string, startTime float64, endTime float64) ([
 }
 
 func GetInstantViewedCountSingle(viewId string, startTime float64, endTime float64) (int64, error) {
-	rows, err := query("SELECT COUNT(DISTINCT B.id) FROM video_view AS A, video_view_time AS B WHERE A.view_id = ? AND A.view_id = B.view_id AND B.time >= ? AND B.time < ?", viewId, startTime, endTime)
+	rows, err := query("SELECT COUNT(DISTINCT B.id) FROM video_view AS A, video_view_time AS B WHERE A.view_id = ? AND A.view_id = B.view_id AND B.flag IS NULL AND B.time >= ? AND B.time < ?", viewId, startTime, endTime)
 	if err != nil {
 		return 0, &InternalError{error: err}
 	}
@@ -524,4 +499,244 @@ func GetInstantViewedCountSingle(viewId string, startTime float64, endTime float
 	}
 
 	return 0, errors.New("COUNT(*) returned 0 rows")
-}
\ No newline at end of file
+}
+
+// GetInstantPersonStatsSingle returns the instant stats of every person of a
+// view that was seen between startTime and endTime, keyed by person index
+func GetInstantPersonStatsSingle(viewId string, startTime float64, endTime float64) (map[string][]float64, error) {
+	rows, err := query("SELECT person_index, AVG(mood), AVG(happy), AVG(surprised), AVG(angry), AVG(disgusted), AVG(afraid), AVG(sad), AVG(engagement) FROM video_view_stats WHERE view_time_id IN (SELECT B.id FROM video_view AS A, video_view_time AS B WHERE A.view_id = ? AND A.view_id = B.view_id AND B.flag IS NULL AND B.time >= ? AND B.time < ?) GROUP BY person_index", viewId, startTime, endTime)
+	if err != nil {
+		return nil, &InternalError{error: err}
+	}
+	defer rows.Close()
+
+	personStats := make(map[string][]float64)
+
+	for rows.Next() {
+		var personIndex int64
+		emotionValues := make([]float64, 8, 8)
+		err = rows.Scan(
+			&personIndex,
+			&emotionValues[0],
+			&emotionValues[1],
+			&emotionValues[2],
+			&emotionValues[3],
+			&emotionValues[4],
+			&emotionValues[5],
+			&emotionValues[6],
+			&emotionValues[7],
+		)
+
+		if err != nil {
+			return nil, &InternalError{error: err}
+		}
+
+		personStats[strconv.FormatInt(personIndex, 10)] = emotionValues
+	}
+
+	return personStats, nil
+}
+
+func GetAnalyzerVersions(videoId string) (map[string]int64, error) {
+	rows, err := query("SELECT analyzer_version, COUNT(*) FROM video_view_stats WHERE view_time_id IN (SELECT B.id FROM video_view AS A, video_view_time AS B WHERE A.video_id = ? AND A.view_id = B.view_id AND B.flag IS NULL) GROUP BY analyzer_version", videoId)
+	if err != nil {
+		return nil, &InternalError{error: err}
+	}
+	defer rows.Close()
+
+	return scanAnalyzerVersions(rows)
+}
+
+func GetAnalyzerVersionsSingle(viewId string) (map[string]int64, error) {
+	rows, err := query("SELECT analyzer_version, COUNT(*) FROM video_view_stats WHERE view_time_id IN (SELECT B.id FROM video_view AS A, video_view_time AS B WHERE A.view_id = ? AND A.view_id = B.view_id AND B.flag IS NULL) GROUP BY analyzer_version", viewId)
+	if err != nil {
+		return nil, &InternalError{error: err}
+	}
+	defer rows.Close()
+
+	return scanAnalyzerVersions(rows)
+}
+
+func scanAnalyzerVersions(rows *sql.Rows) (map[string]int64, error) {
+	analyzerVersions := make(map[string]int64)
+
+	for rows.Next() {
+		var analyzerVersion string
+		var count int64
+		err := rows.Scan(&analyzerVersion, &count)
+
+		if err != nil {
+			return nil, &InternalError{error: err}
+		}
+
+		// rows stored before versions were recorded
+		if analyzerVersion == "" {
+			analyzerVersion = "unknown"
+		}
+
+		analyzerVersions[analyzerVersion] += count
+	}
+
+	return analyzerVersions, nil
+}
+
+// GetFlaggedCounts returns the number of samples of a video left out of the
+// dashboard by the reason they were flagged for
+func GetFlaggedCounts(videoId string) (map[string]int64, error) {
+	rows, err := query("SELECT B.flag, COUNT(*) FROM video_view AS A, video_view_time AS B WHERE A.video_id = ? AND A.view_id = B.view_id AND B.flag IS NOT NULL GROUP BY B.flag", videoId)
+	if err != nil {
+		return nil, &InternalError{error: err}
+	}
+	defer rows.Close()
+
+	return scanFlaggedCounts(rows)
+}
+
+func GetFlaggedCountsSingle(viewId string) (map[string]int64, error) {
+	rows, err := query("SELECT flag, COUNT(*) FROM video_view_time WHERE view_id = ? AND flag IS NOT NULL GROUP BY flag", viewId)
+	if err != nil {
+		return nil, &InternalError{error: err}
+	}
+	defer rows.Close()
+
+	return scanFlaggedCounts(rows)
+}
+
+// GetRejectedCounts returns the number of frames of a video rejected before
+// analysis because of their quality, per reason
+func GetRejectedCounts(videoId string) (map[string]int64, error) {
+	rows, err := query("SELECT B.rejected, COUNT(*) FROM video_view AS A, video_view_time AS B WHERE A.video_id = ? AND A.view_id = B.view_id AND B.rejected IS NOT NULL GROUP BY B.rejected", videoId)
+	if err != nil {
+		return nil, &InternalError{error: err}
+	}
+	defer rows.Close()
+
+	return scanFlaggedCounts(rows)
+}
+
+func GetRejectedCountsSingle(viewId string) (map[string]int64, error) {
+	rows, err := query("SELECT rejected, COUNT(*) FROM video_view_time WHERE view_id = ? AND rejected IS NOT NULL GROUP BY rejected", viewId)
+	if err != nil {
+		return nil, &InternalError{error: err}
+	}
+	defer rows.Close()
+
+	return scanFlaggedCounts(rows)
+}
+
+// GetReusedFrameCount returns the number of frames of a video that reused the
+// analysis of the previous frame of their view instead of being analyzed
+func GetReusedFrameCount(videoId string) (int64, error) {
+	rows, err := query("SELECT COUNT(*) FROM video_view AS A, video_view_time AS B WHERE A.video_id = ? AND A.view_id = B.view_id AND B.reused_from IS NOT NULL", videoId)
+	if err != nil {
+		return 0, &InternalError{error: err}
+	}
+	defer rows.Close()
+
+	return scanCount(rows)
+}
+
+func GetReusedFrameCountSingle(viewId string) (int64, error) {
+	rows, err := query("SELECT COUNT(*) FROM video_view_time WHERE view_id = ? AND reused_from IS NOT NULL", viewId)
+	if err != nil {
+		return 0, &InternalError{error: err}
+	}
+	defer rows.Close()
+
+	return scanCount(rows)
+}
+
+func scanCount(rows *sql.Rows) (int64, error) {
+	if rows.Next() {
+		var count int64
+		err := rows.Scan(&count)
+
+		if err != nil {
+			return 0, &InternalError{error: err}
+		}
+
+		return count, nil
+	}
+
+	return 0, &InternalError{error: errors.New("COUNT(*) returned 0 rows")}
+}
+
+func scanFlaggedCounts(rows *sql.Rows) (map[string]int64, error) {
+	flaggedCounts := make(map[string]int64)
+
+	for rows.Next() {
+		var flag string
+		var count int64
+		err := rows.Scan(&flag, &count)
+
+		if err != nil {
+			return nil, &InternalError{error: err}
+		}
+
+		flaggedCounts[flag] = count
+	}
+
+	return flaggedCounts, nil
+}
+
+// status of a sample sent without a webcam image, as set by veea
+const viewTimeStatusNoImage = 1
+
+// CameraCoverage counts the samples of a video or a view that carried a
+// webcam image and those in which a face was found
+type CameraCoverage struct {
+	Samples   int64 `json:"samples"`
+	WithImage int64 `json:"withImage"`
+	WithFace  int64 `json:"withFace"`
+}
+
+func (coverage *CameraCoverage) ImagePercent() float64 {
+	if coverage.Samples <= 0 {
+		return 0
+	}
+
+	return float64(coverage.WithImage) * 100 / float64(coverage.Samples)
+}
+
+func (coverage *CameraCoverage) FacePercent() float64 {
+	if coverage.Samples <= 0 {
+		return 0
+	}
+
+	return float64(coverage.WithFace) * 100 / float64(coverage.Samples)
+}
+
+func GetCameraCoverage(videoId string) (*CameraCoverage, error) {
+	rows, err := query("SELECT COUNT(*), IFNULL(SUM(B.status <> ?), 0), IFNULL(SUM(B.people_success_count > 0), 0) FROM video_view AS A, video_view_time AS B WHERE A.video_id = ? AND A.view_id = B.view_id AND B.flag IS NULL", viewTimeStatusNoImage, videoId)
+	if err != nil {
+		return nil, &InternalError{error: err}
+	}
+	defer rows.Close()
+
+	return scanCameraCoverage(rows)
+}
+
+func GetCameraCoverageSingle(viewId string) (*CameraCoverage, error) {
+	rows, err := query("SELECT COUNT(*), IFNULL(SUM(status <> ?), 0), IFNULL(SUM(people_success_count > 0), 0) FROM video_view_time WHERE view_id = ? AND flag IS NULL", viewTimeStatusNoImage, viewId)
+	if err != nil {
+		return nil, &InternalError{error: err}
+	}
+	defer rows.Close()
+
+	return scanCameraCoverage(rows)
+}
+
+func scanCameraCoverage(rows *sql.Rows) (*CameraCoverage, error) {
+	if rows.Next() {
+		var coverage CameraCoverage
+		err := rows.Scan(&coverage.Samples, &coverage.WithImage, &coverage.WithFace)
+
+		if err != nil {
+			return nil, &InternalError{error: err}
+		}
+
+		return &coverage, nil
+	}
+
+	return nil, &InternalError{error: errors.New("COUNT(*) returned 0 rows")}
+}
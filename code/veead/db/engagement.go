@@ -0,0 +1,149 @@
+package db
+
+import (
+	"time"
+	"database/sql"
+)
+
+// engagement jobs are only queued and reported here, the veea servers pick
+// them up and rescore the stats rows in chunks
+type EngagementJob struct {
+	Id              int64
+	VideoId         string
+	EngagementModel string
+	Status          int
+	Processed       int64
+	Total           int64
+	Error           string
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+// status of an engagement job
+const (
+	EngagementJobPending = 0
+	EngagementJobRunning = 1
+	EngagementJobDone = 2
+	EngagementJobFailed = 3
+)
+
+func (job *EngagementJob) StatusString() string {
+	switch job.Status {
+	case EngagementJobPending:
+		return "Pending"
+	case EngagementJobRunning:
+		return "Running"
+	case EngagementJobDone:
+		return "Done"
+	default:
+		return "Failed"
+	}
+}
+
+func (job *EngagementJob) Failed() bool {
+	return job.Status == EngagementJobFailed
+}
+
+func (job *EngagementJob) Percent() int64 {
+	if job.Total <= 0 {
+		if job.Status == EngagementJobDone {
+			return 100
+		}
+		return 0
+	}
+
+	return job.Processed * 100 / job.Total
+}
+
+// AddEngagementJob queues the rescoring of a video (or every video if videoId
+// is empty) with the given engagement model
+func AddEngagementJob(userId int64, videoId string, engagementModel string) error {
+	var videoIdValue interface{}
+
+	err := errorFold(
+		UserIdAdminExists(userId),
+		validateEngagementModel(engagementModel),
+	)
+	if err != nil {
+		return &UserError{error: err}
+	}
+
+	var rows *sql.Rows
+	if videoId == "" {
+		rows, err = query("SELECT COUNT(*) FROM video_view_stats")
+	} else {
+		videoIdValue = videoId
+		rows, err = query("SELECT COUNT(*) FROM video_view_stats AS S, video_view_time AS T, video_view AS V WHERE S.view_time_id = T.id AND T.view_id = V.view_id AND V.video_id = ?", videoId)
+	}
+	if err != nil {
+		return &InternalError{error: err}
+	}
+	defer rows.Close()
+
+	var total int64
+	if rows.Next() {
+		err = rows.Scan(&total)
+		if err != nil {
+			return &InternalError{error: err}
+		}
+	}
+
+	_, err = exec("INSERT INTO engagement_job (video_id, engagement_model, total) VALUES (?, ?, ?)", videoIdValue, engagementModel, total)
+	if err != nil {
+		return &InternalError{error: err}
+	}
+
+	return nil
+}
+
+// ResumeEngagementJob queues a failed job again, it continues after the last
+// chunk it committed
+func ResumeEngagementJob(userId int64, jobId int64) error {
+	err := errorFold(
+		UserIdAdminExists(userId),
+	)
+	if err != nil {
+		return &UserError{error: err}
+	}
+
+	_, err = exec("UPDATE engagement_job SET status = ?, error = NULL WHERE id = ? AND status = ?", EngagementJobPending, jobId, EngagementJobFailed)
+	if err != nil {
+		return &InternalError{error: err}
+	}
+
+	return nil
+}
+
+func GetEngagementJobs(userId int64) ([]*EngagementJob, error) {
+	err := errorFold(
+		UserIdAdminExists(userId),
+	)
+	if err != nil {
+		return nil, &UserError{error: err}
+	}
+
+	rows, err := query("SELECT id, video_id, engagement_model, status, processed, total, error, created_at, updated_at FROM engagement_job ORDER BY id DESC")
+	if err != nil {
+		return nil, &InternalError{error: err}
+	}
+	defer rows.Close()
+
+	jobs := []*EngagementJob{}
+
+	for rows.Next() {
+		var job EngagementJob
+		var videoId sql.NullString
+		var errorString sql.NullString
+		err = rows.Scan(&job.Id, &videoId, &job.EngagementModel, &job.Status, &job.Processed, &job.Total, &errorString, &job.CreatedAt, &job.UpdatedAt)
+
+		if err != nil {
+			return nil, &InternalError{error: err}
+		}
+
+		job.VideoId = videoId.String
+		job.Error = errorString.String
+		jobs = append(jobs, &job)
+	}
+
+	return jobs, nil
+}
@@ -3,6 +3,10 @@ package db
 import (
 	"fmt"
 	"errors"
+	"strings"
+
+	"github.com/gpahal/veea/engagement"
+	"github.com/gpahal/veea/privacy"
 )
 
 func validateLength(propertyName string, str string, length int) error {
@@ -20,3 +24,36 @@ func validateUsername(username string) error {
 func validateFullname(fullName string) error {
 	return validateLength("Fullname", fullName, 80)
 }
+
+func validateFrameRetentionDays(days int) error {
+	if days < 0 {
+		return errors.New("Frame retention days must be 0 (keep forever) or more")
+	}
+
+	return nil
+}
+
+func validateEngagementModel(engagementModel string) error {
+	_, err := engagement.Get(engagementModel)
+	return err
+}
+
+func validateVideoDuration(duration float64) error {
+	if duration < 0 {
+		return errors.New("Video duration must be 0 (unknown) or more")
+	}
+
+	return nil
+}
+
+func validateConsentText(body string) error {
+	if strings.TrimSpace(body) == "" {
+		return errors.New("Consent text must not be empty")
+	}
+
+	return validateLength("Consent text", body, 60000)
+}
+
+func validatePrivacyMode(privacyMode string) error {
+	return privacy.Validate(privacyMode)
+}
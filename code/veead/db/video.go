@@ -3,12 +3,30 @@ package db
 import (
 	"time"
 	"errors"
+	"database/sql"
+
+	"github.com/gpahal/veea/privacy"
 )
 
 type Video struct {
-	VideoId   string
-	Name      string
-	CreatedAt time.Time
+	VideoId            string
+	Name               string
+	ArchiveFrames      bool
+	FrameRetentionDays int
+	EngagementModel    string
+	Duration           float64
+	PrivacyMode        string
+	CameraOptional     bool
+	CreatedAt          time.Time
+}
+
+type VideoSettings struct {
+	ArchiveFrames      bool
+	FrameRetentionDays int
+	EngagementModel    string
+	Duration           float64
+	PrivacyMode        string
+	CameraOptional     bool
 }
 
 type View struct {
@@ -16,7 +34,32 @@ type View struct {
 	VideoId string
 	ViewId string
 	VideoDuration float64
+	// version of the consent text accepted for the view, 0 if none
+	ConsentVersion int64
+	// finalized views take no more samples, their watch time is final
+	Finalized bool
+	// ended, unload, abandoned or expired, empty while the view is open
+	EndReason string
 	CreatedAt time.Time
+	Timeline *TimelineSummary
+	Coverage *CameraCoverage
+}
+
+// TimelineSummary totals the playback timeline of a view, all values are in
+// seconds except PauseCount
+type TimelineSummary struct {
+	Watched       float64
+	Rewatched     float64
+	Skipped       float64
+	PauseCount    int64
+	PauseDuration float64
+}
+
+type ViewSegment struct {
+	Kind     string `json:"kind"`
+	Start    float64 `json:"start"`
+	End      float64 `json:"end"`
+	Duration float64 `json:"duration"`
 }
 
 type ViewTime struct {
@@ -56,7 +99,7 @@ func GetVideos(userId int64) ([]*Video, error) {
 		return nil, &UserError{error: err}
 	}
 
-	rows, err := query("SELECT video_id, name, created_at FROM video ORDER BY created_at DESC")
+	rows, err := query("SELECT video_id, name, archive_frames, frame_retention_days, engagement_model, duration, privacy_mode, camera_optional, created_at FROM video ORDER BY created_at DESC")
 	if err != nil {
 		return nil, &InternalError{error: err}
 	}
@@ -66,9 +109,16 @@ func GetVideos(userId int64) ([]*Video, error) {
 
 	for rows.Next() {
 		var video Video
+		var archiveFrames, cameraOptional int
 		err = rows.Scan(
 			&video.VideoId,
 			&video.Name,
+			&archiveFrames,
+			&video.FrameRetentionDays,
+			&video.EngagementModel,
+			&video.Duration,
+			&video.PrivacyMode,
+			&cameraOptional,
 			&video.CreatedAt,
 		)
 
@@ -76,6 +126,9 @@ func GetVideos(userId int64) ([]*Video, error) {
 			return nil, &InternalError{error: err}
 		}
 
+		video.ArchiveFrames = archiveFrames > 0
+		video.CameraOptional = cameraOptional > 0
+
 		videos = append(videos, &video)
 	}
 
@@ -83,7 +136,7 @@ func GetVideos(userId int64) ([]*Video, error) {
 }
 
 func GetVideo(videoId string) (*Video, error) {
-	rows, err := query("SELECT video_id, name, created_at FROM video WHERE video_id = ? LIMIT 1", videoId)
+	rows, err := query("SELECT video_id, name, archive_frames, frame_retention_days, engagement_model, duration, privacy_mode, camera_optional, created_at FROM video WHERE video_id = ? LIMIT 1", videoId)
 	if err != nil {
 		return nil, &InternalError{error: err}
 	}
@@ -91,9 +144,16 @@ func GetVideo(videoId string) (*Video, error) {
 
 	if rows.Next() {
 		var video Video
+		var archiveFrames, cameraOptional int
 		err = rows.Scan(
 			&video.VideoId,
 			&video.Name,
+			&archiveFrames,
+			&video.FrameRetentionDays,
+			&video.EngagementModel,
+			&video.Duration,
+			&video.PrivacyMode,
+			&cameraOptional,
 			&video.CreatedAt,
 		)
 
@@ -101,6 +161,9 @@ func GetVideo(videoId string) (*Video, error) {
 			return nil, &InternalError{error: err}
 		}
 
+		video.ArchiveFrames = archiveFrames > 0
+		video.CameraOptional = cameraOptional > 0
+
 		return &video, nil
 	}
 
@@ -115,7 +178,7 @@ func GetViews(userId int64, otherUserId int64) ([]*View, error) {
 		return nil, &UserError{error: err}
 	}
 
-	rows, err := query("SELECT user_id, video_id, view_id, view_duration, created_at FROM video_view WHERE user_id = ? ORDER BY created_at DESC", otherUserId)
+	rows, err := query("SELECT V.user_id, V.video_id, V.view_id, V.view_duration, IFNULL(C.version, 0), V.finalized_at IS NOT NULL, IFNULL(V.end_reason, ''), V.created_at FROM video_view AS V LEFT JOIN consent AS C ON V.consent_id = C.id WHERE V.user_id = ? ORDER BY V.created_at DESC", otherUserId)
 	if err != nil {
 		return nil, &InternalError{error: err}
 	}
@@ -130,6 +193,9 @@ func GetViews(userId int64, otherUserId int64) ([]*View, error) {
 			&view.VideoId,
 			&view.ViewId,
 			&view.VideoDuration,
+			&view.ConsentVersion,
+			&view.Finalized,
+			&view.EndReason,
 			&view.CreatedAt,
 		)
 
@@ -137,12 +203,122 @@ func GetViews(userId int64, otherUserId int64) ([]*View, error) {
 			return nil, &InternalError{error: err}
 		}
 
+		view.Timeline = &TimelineSummary{}
+		view.Coverage = &CameraCoverage{}
 		views = append(views, &view)
 	}
 
+	err = fillTimelineSummaries(otherUserId, views)
+	if err != nil {
+		return nil, err
+	}
+
+	err = fillCameraCoverages(otherUserId, views)
+	if err != nil {
+		return nil, err
+	}
+
 	return views, nil
 }
 
+func fillTimelineSummaries(userId int64, views []*View) error {
+	viewsById := make(map[string]*View)
+	for _, view := range views {
+		viewsById[view.ViewId] = view
+	}
+
+	rows, err := query("SELECT S.view_id, S.kind, SUM(S.duration), COUNT(*) FROM video_view_segment AS S, video_view AS V WHERE S.view_id = V.view_id AND V.user_id = ? GROUP BY S.view_id, S.kind", userId)
+	if err != nil {
+		return &InternalError{error: err}
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var viewId, kind string
+		var duration float64
+		var count int64
+		err = rows.Scan(&viewId, &kind, &duration, &count)
+
+		if err != nil {
+			return &InternalError{error: err}
+		}
+
+		view, ok := viewsById[viewId]
+		if !ok {
+			continue
+		}
+
+		switch kind {
+		case "watched":
+			view.Timeline.Watched = duration
+		case "rewatched":
+			view.Timeline.Rewatched = duration
+		case "skipped":
+			view.Timeline.Skipped = duration
+		case "pause":
+			view.Timeline.PauseCount = count
+			view.Timeline.PauseDuration = duration
+		}
+	}
+
+	return nil
+}
+
+func fillCameraCoverages(userId int64, views []*View) error {
+	viewsById := make(map[string]*View)
+	for _, view := range views {
+		viewsById[view.ViewId] = view
+	}
+
+	rows, err := query("SELECT T.view_id, COUNT(*), SUM(T.status <> ?), SUM(T.people_success_count > 0) FROM video_view_time AS T, video_view AS V WHERE T.view_id = V.view_id AND V.user_id = ? AND T.flag IS NULL GROUP BY T.view_id", viewTimeStatusNoImage, userId)
+	if err != nil {
+		return &InternalError{error: err}
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var viewId string
+		var coverage CameraCoverage
+		err = rows.Scan(&viewId, &coverage.Samples, &coverage.WithImage, &coverage.WithFace)
+
+		if err != nil {
+			return &InternalError{error: err}
+		}
+
+		view, ok := viewsById[viewId]
+		if !ok {
+			continue
+		}
+
+		view.Coverage = &coverage
+	}
+
+	return nil
+}
+
+func GetViewSegments(viewId string) ([]*ViewSegment, error) {
+	rows, err := query("SELECT kind, start_time, end_time, duration FROM video_view_segment WHERE view_id = ? ORDER BY start_time", viewId)
+	if err != nil {
+		return nil, &InternalError{error: err}
+	}
+	defer rows.Close()
+
+	segments := []*ViewSegment{}
+
+	for rows.Next() {
+		var segment ViewSegment
+		err = rows.Scan(&segment.Kind, &segment.Start, &segment.End, &segment.Duration)
+
+		if err != nil {
+			return nil, &InternalError{error: err}
+		}
+
+		segments = append(segments, &segment)
+	}
+
+	return segments, nil
+}
+
 func AddVideo(userId int64, videoId string, name string) error {
 	err := errorFold(
 		UserIdAdminExists(userId),
@@ -176,6 +352,87 @@ func UpdateVideo(userId int64, videoId string, name string) error {
 	return nil
 }
 
+func UpdateVideoSettings(userId int64, videoId string, settings *VideoSettings) error {
+	err := errorFold(
+		UserIdAdminExists(userId),
+		validateFrameRetentionDays(settings.FrameRetentionDays),
+		validateEngagementModel(settings.EngagementModel),
+		validateVideoDuration(settings.Duration),
+		validatePrivacyMode(settings.PrivacyMode),
+	)
+	if err != nil {
+		return &UserError{error: err}
+	}
+
+	archiveFrames := 0
+	if settings.ArchiveFrames {
+		archiveFrames = 1
+	}
+	cameraOptional := 0
+	if settings.CameraOptional {
+		cameraOptional = 1
+	}
+
+	tx, err := transaction()
+	if err != nil {
+		return &InternalError{error: err}
+	}
+
+	_, err = tx.Exec("UPDATE video SET archive_frames = ?, frame_retention_days = ?, engagement_model = ?, duration = ?, privacy_mode = ?, camera_optional = ? WHERE video_id = ?", archiveFrames, settings.FrameRetentionDays, settings.EngagementModel, settings.Duration, settings.PrivacyMode, cameraOptional, videoId)
+	if err != nil {
+		tx.Rollback()
+		return &InternalError{error: err}
+	}
+
+	err = scrubDemographics(tx, videoId, settings.PrivacyMode)
+	if err != nil {
+		tx.Rollback()
+		return &InternalError{error: err}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return &InternalError{error: err}
+	}
+
+	return nil
+}
+
+// scrubDemographics clears the demographics already stored for a video that
+// its privacy mode no longer allows, so that switching to a stricter mode
+// also applies to the faces seen before
+func scrubDemographics(tx *sql.Tx, videoId string, privacyMode string) error {
+	var set string
+	switch {
+	case !privacy.KeepsGender(privacyMode):
+		set = "S.gender = NULL, S.age = NULL, S.age_bucket = NULL"
+	case !privacy.KeepsAge(privacyMode):
+		set = "S.age = NULL"
+	default:
+		return nil
+	}
+
+	_, err := tx.Exec("UPDATE video_view_stats AS S, video_view_time AS T, video_view AS V SET " + set + " WHERE S.view_time_id = T.id AND T.view_id = V.view_id AND V.video_id = ?", videoId)
+	return err
+}
+
+// SetVideoDurationIfUnknown sets the duration of a video that has none yet
+func SetVideoDurationIfUnknown(videoId string, duration float64) error {
+	err := errorFold(
+		validateVideoDuration(duration),
+	)
+	if err != nil {
+		return &UserError{error: err}
+	}
+
+	_, err = exec("UPDATE video SET duration = ? WHERE video_id = ? AND duration = 0", duration, videoId)
+	if err != nil {
+		return &InternalError{error: err}
+	}
+
+	return nil
+}
+
 func DeleteVideo(userId int64, videoId string) error {
 	err := errorFold(
 		UserIdAdminExists(userId),
@@ -7,6 +7,7 @@ import (
 	"github.com/gpahal/veead/resources"
 	"github.com/gin-gonic/gin"
 	"github.com/gpahal/veead/conf"
+	"github.com/gpahal/veea/engagement"
 )
 
 func main() {
@@ -15,6 +16,11 @@ func main() {
 		panic("Unable to create admin user")
 	}
 
+	err = engagement.LoadModels()
+	if err != nil {
+		panic("Unable to load engagement models: " + err.Error())
+	}
+
 	router := gin.Default()
 
 	router.LoadHTMLGlob(conf.BasePath + "templates/*")
@@ -49,10 +55,20 @@ func main() {
 		authRouter.POST("/update_video/:videoId", resources.UpdateVideoHandler)
 		authRouter.POST("/delete_video/:videoId", resources.DeleteVideoHandler)
 
+		authRouter.GET("/engagement", resources.GetEngagementJobsHandler)
+		authRouter.POST("/engagement", resources.AddEngagementJobHandler)
+		authRouter.POST("/engagement/:jobId/resume", resources.ResumeEngagementJobHandler)
+
+		authRouter.GET("/consent", resources.GetConsentTextsHandler)
+		authRouter.POST("/consent", resources.AddConsentTextHandler)
+
 		videoRouter := authRouter.Group("/video/:videoId", resources.VideoMiddleware)
 		{
 			videoRouter.GET("/", resources.GetIndexHandler)
 
+			videoRouter.GET("/settings", resources.GetVideoSettingsHandler)
+			videoRouter.POST("/settings", resources.VideoSettingsHandler)
+
 			videoRouter.GET("/all/dashboard", resources.GetDashboardHandler)
 			videoRouter.POST("/all/dashboard_data", resources.DashboardDataHandler)
 
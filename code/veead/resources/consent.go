@@ -0,0 +1,54 @@
+package resources
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gpahal/veead/db"
+)
+
+func GetConsentTextsHandler(c *gin.Context) {
+	account := GetUser(c)
+
+	consentTexts, err := db.GetConsentTexts(account.Id)
+	if err != nil {
+		c.HTML(http.StatusOK, "consent_texts.html", gin.H{
+			"Account": account,
+			"Message": ErrorPrefix(err) + ": " + err.Error(),
+		})
+		return
+	}
+
+	var current *db.ConsentText
+	if len(consentTexts) > 0 {
+		current = consentTexts[0]
+	}
+
+	c.HTML(http.StatusOK, "consent_texts.html", gin.H{
+		"Account": account,
+		"Message": c.Query("msg"),
+		"Current": current,
+		"ConsentTexts": consentTexts,
+	})
+}
+
+func AddConsentTextHandler(c *gin.Context) {
+	account := GetUser(c)
+	var form struct {
+		Body string `form:"body" binding:"required"`
+	}
+
+	if c.Bind(&form) == nil {
+		err := db.AddConsentText(account.Id, form.Body)
+		if err != nil {
+			c.Redirect(http.StatusFound, fmt.Sprintf("/admin/consent?msg=%s", url.QueryEscape("Unable to publish consent text (" + ErrorString(err) + ")")))
+			return
+		}
+
+		c.Redirect(http.StatusFound, "/admin/consent")
+	} else {
+		c.Redirect(http.StatusFound, fmt.Sprintf("/admin/consent?msg=%s", url.QueryEscape("Unable to publish consent text (input error)")))
+	}
+}
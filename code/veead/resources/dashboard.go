@@ -7,6 +7,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/gpahal/veead/db"
 	"github.com/gpahal/veea/conf"
+	"github.com/gpahal/veea/privacy"
 )
 
 type DashboardStats struct {
@@ -17,9 +18,17 @@ type DashboardStats struct {
 	MaleCount int64 `json:"maleCount"`
 	FemaleCount int64 `json:"femaleCount"`
 	AgeCounts []int64 `json:"ageCounts"`
+	PrivacyMode string `json:"privacyMode"`
 	Stats []float64 `json:"stats"`
 	InstantStats map[string][]float64 `json:"instantStats"`
 	InstantViewedCount map[string]int64 `json:"instantViewedCount"`
+	AnalyzerVersions map[string]int64 `json:"analyzerVersions"`
+	PersonInstantStats map[string]map[string][]float64 `json:"personInstantStats,omitempty"`
+	Timeline []*db.ViewSegment `json:"timeline,omitempty"`
+	FlaggedCounts map[string]int64 `json:"flaggedCounts"`
+	ReusedFrames int64 `json:"reusedFrames"`
+	RejectedCounts map[string]int64 `json:"rejectedCounts"`
+	CameraCoverage *db.CameraCoverage `json:"cameraCoverage"`
 }
 
 func GetDashboardHandler(c *gin.Context) {
@@ -46,6 +55,8 @@ func DashboardDataHandler(c *gin.Context) {
 			return
 		}
 
+		learnVideoDuration(video, form.VideoDuration)
+
 		totalViews, err := db.GetTotalViews(video.VideoId)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{})
@@ -60,7 +71,7 @@ func DashboardDataHandler(c *gin.Context) {
 		}
 		ds.UniqueVisitors = uniqueVisitors
 
-		avgViewDuration, successful, err := db.GetAverageViewDuration(video.VideoId, form.VideoDuration)
+		avgViewDuration, successful, err := db.GetAverageViewDuration(video.VideoId)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{})
 			return
@@ -68,26 +79,35 @@ func DashboardDataHandler(c *gin.Context) {
 		ds.AvgViewDurationPresent = successful
 		ds.AvgViewDuration = avgViewDuration
 
-		maleCount, err := db.GetMaleCount(video.VideoId)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{})
-			return
-		}
-		ds.MaleCount = maleCount
+		// demographics of a video in privacy mode none are not shown, even
+		// the ones stored before it was switched to it
+		ds.PrivacyMode = video.PrivacyMode
+		ds.AgeCounts = make([]int64, privacy.AgeBucketCount, privacy.AgeBucketCount)
 
-		femaleCount, err := db.GetFemaleCount(video.VideoId)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{})
-			return
+		if privacy.KeepsGender(video.PrivacyMode) {
+			maleCount, err := db.GetMaleCount(video.VideoId)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{})
+				return
+			}
+			ds.MaleCount = maleCount
+
+			femaleCount, err := db.GetFemaleCount(video.VideoId)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{})
+				return
+			}
+			ds.FemaleCount = femaleCount
 		}
-		ds.FemaleCount = femaleCount
 
-		ageCounts, err := db.GetAgeCounts(video.VideoId)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{})
-			return
+		if privacy.KeepsAgeBucket(video.PrivacyMode) {
+			ageCounts, err := db.GetAgeCounts(video.VideoId)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{})
+				return
+			}
+			ds.AgeCounts = ageCounts
 		}
-		ds.AgeCounts = ageCounts
 
 		//maxEngagement, err := db.GetMaxEngagement()
 		//if err != nil {
@@ -108,6 +128,41 @@ func DashboardDataHandler(c *gin.Context) {
 		//}
 		ds.Stats = stats
 
+		analyzerVersions, err := db.GetAnalyzerVersions(video.VideoId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{})
+			return
+		}
+		ds.AnalyzerVersions = analyzerVersions
+
+		flaggedCounts, err := db.GetFlaggedCounts(video.VideoId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{})
+			return
+		}
+		ds.FlaggedCounts = flaggedCounts
+
+		reusedFrames, err := db.GetReusedFrameCount(video.VideoId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{})
+			return
+		}
+		ds.ReusedFrames = reusedFrames
+
+		rejectedCounts, err := db.GetRejectedCounts(video.VideoId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{})
+			return
+		}
+		ds.RejectedCounts = rejectedCounts
+
+		cameraCoverage, err := db.GetCameraCoverage(video.VideoId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{})
+			return
+		}
+		ds.CameraCoverage = cameraCoverage
+
 		ds.InstantStats = make(map[string][]float64)
 		ds.InstantViewedCount = make(map[string]int64)
 
@@ -171,6 +226,8 @@ func DashboardSingleDataHandler(c *gin.Context) {
 			return
 		}
 
+		learnVideoDuration(video, form.VideoDuration)
+
 		err := db.VideoIdViewIdExists(video.VideoId, viewId)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{})
@@ -181,7 +238,7 @@ func DashboardSingleDataHandler(c *gin.Context) {
 
 		ds.UniqueVisitors = 1
 
-		avgViewDuration, successful, err := db.GetAverageViewDurationSingle(viewId, form.VideoDuration)
+		avgViewDuration, successful, err := db.GetAverageViewDurationSingle(viewId)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{})
 			return
@@ -189,26 +246,35 @@ func DashboardSingleDataHandler(c *gin.Context) {
 		ds.AvgViewDurationPresent = successful
 		ds.AvgViewDuration = avgViewDuration
 
-		maleCount, err := db.GetMaleCountSingle(viewId)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{})
-			return
-		}
-		ds.MaleCount = maleCount
+		// demographics of a video in privacy mode none are not shown, even
+		// the ones stored before it was switched to it
+		ds.PrivacyMode = video.PrivacyMode
+		ds.AgeCounts = make([]int64, privacy.AgeBucketCount, privacy.AgeBucketCount)
 
-		femaleCount, err := db.GetFemaleCountSingle(viewId)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{})
-			return
+		if privacy.KeepsGender(video.PrivacyMode) {
+			maleCount, err := db.GetMaleCountSingle(viewId)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{})
+				return
+			}
+			ds.MaleCount = maleCount
+
+			femaleCount, err := db.GetFemaleCountSingle(viewId)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{})
+				return
+			}
+			ds.FemaleCount = femaleCount
 		}
-		ds.FemaleCount = femaleCount
 
-		ageCounts, err := db.GetAgeCountsSingle(viewId)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{})
-			return
+		if privacy.KeepsAgeBucket(video.PrivacyMode) {
+			ageCounts, err := db.GetAgeCountsSingle(viewId)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{})
+				return
+			}
+			ds.AgeCounts = ageCounts
 		}
-		ds.AgeCounts = ageCounts
 
 		//maxEngagement, err := db.GetMaxEngagement()
 		//if err != nil {
@@ -229,8 +295,51 @@ func DashboardSingleDataHandler(c *gin.Context) {
 		//}
 		ds.Stats = stats
 
+		analyzerVersions, err := db.GetAnalyzerVersionsSingle(viewId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{})
+			return
+		}
+		ds.AnalyzerVersions = analyzerVersions
+
+		flaggedCounts, err := db.GetFlaggedCountsSingle(viewId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{})
+			return
+		}
+		ds.FlaggedCounts = flaggedCounts
+
+		reusedFrames, err := db.GetReusedFrameCountSingle(viewId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{})
+			return
+		}
+		ds.ReusedFrames = reusedFrames
+
+		rejectedCounts, err := db.GetRejectedCountsSingle(viewId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{})
+			return
+		}
+		ds.RejectedCounts = rejectedCounts
+
+		cameraCoverage, err := db.GetCameraCoverageSingle(viewId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{})
+			return
+		}
+		ds.CameraCoverage = cameraCoverage
+
+		timeline, err := db.GetViewSegments(viewId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{})
+			return
+		}
+		ds.Timeline = timeline
+
 		ds.InstantStats = make(map[string][]float64)
 		ds.InstantViewedCount = make(map[string]int64)
+		ds.PersonInstantStats = make(map[string]map[string][]float64)
 
 		var time float64
 		for time < form.VideoDuration {
@@ -249,6 +358,13 @@ func DashboardSingleDataHandler(c *gin.Context) {
 			}
 			ds.InstantStats[midTimeString] = instantStats
 
+			personInstantStats, err := db.GetInstantPersonStatsSingle(viewId, startTime, endTime)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{})
+				return
+			}
+			ds.PersonInstantStats[midTimeString] = personInstantStats
+
 			instantViewedCount, err := db.GetInstantViewedCountSingle(viewId, startTime, endTime)
 			if err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{})
@@ -263,4 +379,17 @@ func DashboardSingleDataHandler(c *gin.Context) {
 	} else {
 		c.JSON(http.StatusBadRequest, gin.H{})
 	}
-}
\ No newline at end of file
+}
+
+// learnVideoDuration stores the duration reported by the admin's player for
+// videos without one, veea needs it to flag samples past the end of the video
+func learnVideoDuration(video *db.Video, videoDuration float64) {
+	if video.Duration > 0 || videoDuration <= 0 {
+		return
+	}
+
+	err := db.SetVideoDurationIfUnknown(video.VideoId, videoDuration)
+	if err == nil {
+		video.Duration = videoDuration
+	}
+}
@@ -0,0 +1,75 @@
+package resources
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gpahal/veead/db"
+	"github.com/gpahal/veea/engagement"
+)
+
+func GetEngagementJobsHandler(c *gin.Context) {
+	account := GetUser(c)
+
+	videos, err := db.GetVideos(account.Id)
+	if err != nil {
+		c.HTML(http.StatusOK, "engagement_jobs.html", gin.H{
+			"Account": account,
+			"Message": ErrorPrefix(err) + ": " + err.Error(),
+		})
+		return
+	}
+
+	jobs, err := db.GetEngagementJobs(account.Id)
+	if err != nil {
+		c.HTML(http.StatusOK, "engagement_jobs.html", gin.H{
+			"Account": account,
+			"Message": ErrorPrefix(err) + ": " + err.Error(),
+		})
+		return
+	}
+
+	c.HTML(http.StatusOK, "engagement_jobs.html", gin.H{
+		"Account": account,
+		"Message": c.Query("msg"),
+		"Videos": videos,
+		"Jobs": jobs,
+		"VideoId": c.Query("video"),
+		"EngagementModels": engagement.Ids(),
+	})
+}
+
+func AddEngagementJobHandler(c *gin.Context) {
+	account := GetUser(c)
+	var form struct {
+		VideoId         string `form:"videoid"`
+		EngagementModel string `form:"engagementmodel" binding:"required"`
+	}
+
+	if c.Bind(&form) == nil {
+		err := db.AddEngagementJob(account.Id, form.VideoId, form.EngagementModel)
+		if err != nil {
+			c.Redirect(http.StatusFound, fmt.Sprintf("/admin/engagement?msg=%s", url.QueryEscape("Unable to recompute engagement (" + ErrorString(err) + ")")))
+			return
+		}
+
+		c.Redirect(http.StatusFound, "/admin/engagement")
+	} else {
+		c.Redirect(http.StatusFound, fmt.Sprintf("/admin/engagement?msg=%s", url.QueryEscape("Unable to recompute engagement (input error)")))
+	}
+}
+
+func ResumeEngagementJobHandler(c *gin.Context) {
+	account := GetUser(c)
+	jobId := StringToInt64Unsafe(c.Param("jobId"))
+
+	err := db.ResumeEngagementJob(account.Id, jobId)
+	if err != nil {
+		c.Redirect(http.StatusFound, fmt.Sprintf("/admin/engagement?msg=%s", url.QueryEscape("Unable to resume engagement job (" + ErrorString(err) + ")")))
+		return
+	}
+
+	c.Redirect(http.StatusFound, "/admin/engagement")
+}
@@ -7,6 +7,8 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/gpahal/veead/db"
+	"github.com/gpahal/veea/engagement"
+	"github.com/gpahal/veea/privacy"
 )
 
 func GetIndexHandler(c *gin.Context) {
@@ -87,6 +89,56 @@ func DeleteVideoHandler(c *gin.Context) {
 	c.Redirect(http.StatusFound, "/admin/videos")
 }
 
+func GetVideoSettingsHandler(c *gin.Context) {
+	account := GetUser(c)
+	video := GetVideo(c)
+	path := GetPath(c)
+
+	c.HTML(http.StatusOK, "video_settings.html", gin.H{
+		"Account": account,
+		"Message": c.Query("msg"),
+		"Path": path,
+		"Video": video,
+		"EngagementModels": engagement.Ids(),
+		"PrivacyModes": privacy.Modes(),
+	})
+}
+
+func VideoSettingsHandler(c *gin.Context) {
+	account := GetUser(c)
+	video := GetVideo(c)
+	path := GetPath(c)
+	var form struct {
+		ArchiveFrames      bool   `form:"archiveframes"`
+		FrameRetentionDays int    `form:"frameretentiondays"`
+		EngagementModel    string `form:"engagementmodel" binding:"required"`
+		Duration           float64 `form:"duration"`
+		PrivacyMode        string `form:"privacymode" binding:"required"`
+		CameraOptional     bool   `form:"cameraoptional"`
+	}
+
+	if c.Bind(&form) == nil {
+		settings := &db.VideoSettings{
+			ArchiveFrames: form.ArchiveFrames,
+			FrameRetentionDays: form.FrameRetentionDays,
+			EngagementModel: form.EngagementModel,
+			Duration: form.Duration,
+			PrivacyMode: form.PrivacyMode,
+			CameraOptional: form.CameraOptional,
+		}
+
+		err := db.UpdateVideoSettings(account.Id, video.VideoId, settings)
+		if err != nil {
+			c.Redirect(http.StatusFound, fmt.Sprintf("%s/settings?msg=%s", path, url.QueryEscape("Unable to update video settings (" + ErrorString(err) + ")")))
+			return
+		}
+
+		c.Redirect(http.StatusFound, path + "/settings")
+	} else {
+		c.Redirect(http.StatusFound, fmt.Sprintf("%s/settings?msg=%s", path, url.QueryEscape("Unable to update video settings (input error)")))
+	}
+}
+
 func VideoMiddleware(c *gin.Context) {
 	videoId := c.Param("videoId")
 	path := fmt.Sprintf("/admin/video/%s", videoId)